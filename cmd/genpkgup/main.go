@@ -1,77 +1,158 @@
 package main
 
 import (
-	tar2 "archive/tar"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/neutralinsomniac/obsdpkgup/gzip"
 	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+	"io"
+	"io/fs"
 	"io/ioutil"
-	"net/http"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 )
 
-func getContentsFromPkgUrl(url string) []byte {
-	resp, err := http.Get(url)
+func getMetadataFromPkg(pkgMirror openbsd.Mirror, pkgName string) (openbsd.PackageMetadata, bool) {
+	pkg, err := pkgMirror.OpenPackage(pkgName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error downloading package %s: %s\n", url, err)
+		fmt.Fprintf(os.Stderr, "Error downloading package %s: %s\n", pkgName, err)
 		goto Error
 	}
 
-	defer resp.Body.Close()
+	defer pkg.Close()
 
-	switch resp.StatusCode {
-	case 200:
-		gz, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error decompressing %s: %s\n", url, err)
-			goto Error
+	{
+		var body io.Reader = pkg
+		if verifySignatures {
+			_, body, err = openbsd.NewSignifyVerifier(pkg, keyDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Refusing to index %s: %s\n", pkgName, err)
+				goto Error
+			}
 		}
 
-		tar := tar2.NewReader(gz)
-
-		hdr, err := tar.Next()
+		metadata, err := openbsd.ReadPackageMetadata(body)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error decompressing %s: %s\n", url, err)
+			fmt.Fprintf(os.Stderr, "Error reading metadata of %s: %s\n", pkgName, err)
 			goto Error
 		}
-		for err == nil && hdr.Name != "+CONTENTS" {
-			hdr, err = tar.Next()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error walking archive %s: %s\n", url, err)
+
+		if verifySignatures {
+			// the signed hashes cover the whole package, so read it all
+			if _, err := io.Copy(io.Discard, body); err != nil {
+				fmt.Fprintf(os.Stderr, "Refusing to index %s: %s\n", pkgName, err)
 				goto Error
 			}
 		}
-		contents, _ := ioutil.ReadAll(tar)
-		return contents
-	case 404:
-		fmt.Fprintf(os.Stderr, "404 while downloading package: %s\n", url)
-		goto Error
-	default:
-		fmt.Fprintf(os.Stderr, "unexpected HTTP response (%d) while downloading package: %s\n", resp.StatusCode, url)
-		goto Error
+
+		return metadata, true
 	}
 
 Error:
-	return []byte{}
+	return openbsd.PackageMetadata{}, false
+}
+
+// getIndexLine returns the pkgup index line for a package
+func getIndexLine(pkgMirror openbsd.Mirror, pkgName string) (string, bool) {
+	metadata, ok := getMetadataFromPkg(pkgMirror, pkgName)
+	if !ok {
+		// if we failed to get/decompress +CONTENTS, skip this package
+		return "", false
+	}
+
+	plist, err := metadata.PackingList()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing +CONTENTS of %s: %s\n", pkgName, err)
+		return "", false
+	}
+	if plist.Pkgpath == "" {
+		fmt.Fprintf(os.Stderr, "No pkgpath in +CONTENTS of %s\n", pkgName)
+		return "", false
+	}
+
+	signature := plist.Signature()
+
+	// the one-line description trails the fields older clients read
+	if comment := metadata.Comment(); comment != "" {
+		return fmt.Sprintf("%s %s %s %s", pkgName, signature, plist.Pkgpath, comment), true
+	}
+	return fmt.Sprintf("%s %s %s", pkgName, signature, plist.Pkgpath), true
+}
+
+// getIndexTxt returns the index.txt of a packages directory, or nothing if
+// the directory doesn't exist (yet), as packages-stable right after a release
+func getIndexTxt(pkgMirror openbsd.Mirror) string {
+	indexString, err := openbsd.GetIndexTxt(pkgMirror)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ""
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to retrieve index.txt at %s: %s\n", pkgMirror, err)
+		os.Exit(1)
+	}
+	return indexString
+}
+
+func parseIndexTxt(pkgMirror openbsd.Mirror, indexString string) []openbsd.IndexEntry {
+	entries, err := openbsd.ParseIndexTxt(indexString)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse index.txt at %s: %s\n", pkgMirror, err)
+		os.Exit(1)
+	}
+	return entries
+}
+
+func newMirror(url string) openbsd.Mirror {
+	pkgMirror, err := openbsd.NewMirror(url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	return pkgMirror
+}
+
+// readReleaseIndex returns the package lines of a pkgup index previously
+// written with -R, or false if there's no usable one
+func readReleaseIndex(path string) ([]string, bool) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		return nil, false
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) < 2 || lines[0] != strconv.Itoa(indexFormatVersion) {
+		fmt.Fprintf(os.Stderr, "ignoring %s: not a version %d pkgup index\n", path, indexFormatVersion)
+		return nil, false
+	}
+
+	return lines[2:], true
 }
 
 var mirror string
 var arch string
 var version string
 var showProgress bool
+var verifySignatures bool
+var keyDir string
+var releaseIndexFile string
 
+// the one-line comment trailing a package line was added without a new
+// version: readers only look at the first three fields, so it's compatible
+// with every obsdpkgup that reads version 1
 var indexFormatVersion = 1
 
-var pkgpathRe = regexp.MustCompilePOSIX(`^@comment pkgpath=([^ ]+).*$`)
-
 func main() {
-	flag.StringVar(&mirror, "m", "https://cdn.openbsd.org/pub/OpenBSD", "Mirror URL")
+	flag.StringVar(&mirror, "m", "https://cdn.openbsd.org/pub/OpenBSD", "Mirror URL or local directory")
 	flag.StringVar(&arch, "a", "", "Architecture")
 	flag.StringVar(&version, "v", "", "Version")
 	flag.BoolVar(&showProgress, "p", false, "Show progress")
+	flag.BoolVar(&verifySignatures, "S", false, "Verify package signatures (downloads complete packages)")
+	flag.StringVar(&keyDir, "k", openbsd.SignifyKeyDir, "Directory containing signify public keys")
+	flag.StringVar(&releaseIndexFile, "R", "", "Release packages index to reuse, or to write if it doesn't exist (releases only)")
 
 	flag.Parse()
 
@@ -85,26 +166,45 @@ func main() {
 		os.Exit(1)
 	}
 
-	var url string
+	// a release's packages-stable only has what was updated since the
+	// release, so index it on top of the release packages
+	var pkgMirror, releaseMirror openbsd.Mirror
 	if version == "snapshots" {
-		url = fmt.Sprintf("%s/%s/packages/%s/", mirror, version, arch)
+		pkgMirror = newMirror(fmt.Sprintf("%s/%s/packages/%s/", mirror, version, arch))
 	} else {
-		url = fmt.Sprintf("%s/%s/packages-stable/%s/", mirror, version, arch)
+		pkgMirror = newMirror(fmt.Sprintf("%s/%s/packages-stable/%s/", mirror, version, arch))
+		releaseMirror = newMirror(fmt.Sprintf("%s/%s/packages/%s/", mirror, version, arch))
 	}
 
 	// retrieve the index.txt first
-	indexString, err := openbsd.GetIndexTxt(url)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to retrieve index.txt at %s: %s\n", url, err)
+	indexString := getIndexTxt(pkgMirror)
+	quirksMirror := pkgMirror
+	var releaseIndexString string
+	if releaseMirror != nil {
+		releaseIndexString = getIndexTxt(releaseMirror)
+		quirksMirror = openbsd.NewMergedMirror(pkgMirror, releaseMirror)
+	}
+	if indexString == "" && releaseIndexString == "" {
+		fmt.Fprintf(os.Stderr, "failed to retrieve index.txt at %s\n", quirksMirror)
 		os.Exit(1)
 	}
 
-	// snag quirks for timestamp
-	quirksSignifyBlock, err := openbsd.GetQuirksSignifyBlockFromIndex(url, indexString)
+	// snag quirks for timestamp; an updated quirks is in packages-stable
+	quirksSignifyBlock, err := openbsd.GetQuirksSignifyBlockFromIndex(quirksMirror, indexString+"\n"+releaseIndexString)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
+	if verifySignatures {
+		block, err := openbsd.NewSignifyBlockFromString(quirksSignifyBlock)
+		if err == nil {
+			err = block.VerifyWithKeyDir(keyDir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to verify quirks signature: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	quirksDate, err := openbsd.GetSignifyTimestampFromSignifyBlock(quirksSignifyBlock)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
@@ -117,31 +217,75 @@ func main() {
 	// write quirks date
 	fmt.Println(quirksDate)
 
-	lines := strings.Split(indexString, "\n")
-	numPkgsToProcess := len(lines)
-	for i, line := range lines {
+	entries := parseIndexTxt(pkgMirror, indexString)
+	var releaseEntries []openbsd.IndexEntry
+	var releaseLines []string
+	haveReleaseLines := false
+	if releaseMirror != nil {
+		if releaseIndexFile != "" {
+			releaseLines, haveReleaseLines = readReleaseIndex(releaseIndexFile)
+		}
+		if !haveReleaseLines {
+			releaseEntries = parseIndexTxt(releaseMirror, releaseIndexString)
+		}
+	}
+
+	// packages in packages-stable take precedence over the same ones in
+	// packages
+	seen := make(map[string]bool)
+
+	numPkgsToProcess := len(entries) + len(releaseEntries)
+	for i, entry := range entries {
 		if showProgress {
 			fmt.Fprintf(os.Stderr, "\r%d/%d", i, numPkgsToProcess)
 		}
-		if len(line) == 0 {
-			continue
-		}
-		s := strings.Fields(line)
-		pkgName := s[9]
 		// doesn't look like a package to me
-		if !strings.HasSuffix(pkgName, ".tgz") {
+		if !entry.IsPackage {
 			continue
 		}
-		contents := getContentsFromPkgUrl(fmt.Sprintf("%s/%s", url, pkgName))
-		if len(contents) == 0 {
-			// if we failed to get/decompress +CONTENTS, skip this package
-			continue
+		if line, ok := getIndexLine(pkgMirror, entry.Filename); ok {
+			seen[entry.Filename] = true
+			fmt.Println(line)
 		}
+	}
 
-		signature := openbsd.GenerateSignatureFromContents(contents)
+	if releaseMirror == nil {
+		return
+	}
+
+	if !haveReleaseLines {
+		for i, entry := range releaseEntries {
+			if showProgress {
+				fmt.Fprintf(os.Stderr, "\r%d/%d", len(entries)+i, numPkgsToProcess)
+			}
+			if !entry.IsPackage {
+				continue
+			}
+			// the release tree doesn't change, so only skip packages-stable
+			// duplicates if there's no cache to fill
+			if seen[entry.Filename] && releaseIndexFile == "" {
+				continue
+			}
+			if line, ok := getIndexLine(releaseMirror, entry.Filename); ok {
+				releaseLines = append(releaseLines, line)
+			}
+		}
 
-		pkgPath := pkgpathRe.FindSubmatch(contents)[1]
+		if releaseIndexFile != "" {
+			cache := fmt.Sprintf("%d\n%s\n", indexFormatVersion, quirksDate)
+			for _, line := range releaseLines {
+				cache += line + "\n"
+			}
+			if err := ioutil.WriteFile(releaseIndexFile, []byte(cache), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write release index: %s\n", err)
+			}
+		}
+	}
 
-		fmt.Printf("%s %s %s\n", pkgName, signature, pkgPath)
+	for _, line := range releaseLines {
+		if seen[strings.SplitN(line, " ", 2)[0]] {
+			continue
+		}
+		fmt.Println(line)
 	}
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	version2 "github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+const defaultConfigPath = "/etc/obsdpkgup.conf"
+
+// Config holds the settings read from the configuration file. Each
+// non-empty line is a directive; "#" starts a comment:
+//
+//	# only upgrade postgresql-server within 15.x
+//	hold postgresql-server >=15 and <16
+//	hold php <8.3
+type Config struct {
+	holds map[string]version2.Constraint // stem -> allowed versions
+}
+
+func parseConfig(r io.Reader, name string) (Config, error) {
+	config := Config{
+		holds: make(map[string]version2.Constraint),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "hold":
+			if len(fields) < 3 {
+				return Config{}, fmt.Errorf("%s:%d: usage: hold stem constraint", name, lineNum)
+			}
+			constraint, err := version2.NewConstraintFromString(strings.Join(fields[2:], " "))
+			if err != nil {
+				return Config{}, fmt.Errorf("%s:%d: %s", name, lineNum, err)
+			}
+			config.holds[fields[1]] = constraint
+		default:
+			return Config{}, fmt.Errorf("%s:%d: unknown directive %q", name, lineNum, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Config{}, fmt.Errorf("error reading %s: %s", name, err)
+	}
+
+	return config, nil
+}
+
+// readConfig parses the configuration file at path. A missing file at the
+// default location is not an error.
+func readConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && path == defaultConfigPath {
+			return parseConfig(strings.NewReader(""), path)
+		}
+		return Config{}, err
+	}
+	defer f.Close()
+
+	return parseConfig(f, path)
+}
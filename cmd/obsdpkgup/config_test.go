@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	version2 "github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig(strings.NewReader(`
+# only upgrade postgresql-server within 15.x
+hold postgresql-server >=15 and <16
+hold php <8.3 or >=9.0 # comment
+`), "test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.holds) != 2 {
+		t.Fatalf("unexpected holds %v", config.holds)
+	}
+	v := func(s string) version2.Version {
+		pkg, err := version2.NewPackageFromString("x-" + s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pkg.Name.Version
+	}
+	if pg := config.holds["postgresql-server"]; !pg.Check(v("15.4")) || pg.Check(v("16.0")) {
+		t.Errorf("unexpected postgresql-server hold %s", pg)
+	}
+	if php := config.holds["php"]; !php.Check(v("8.2.11")) || php.Check(v("8.3.0")) || !php.Check(v("9.0")) {
+		t.Errorf("unexpected php hold %s", php)
+	}
+
+	for _, bad := range []string{
+		"hold php",
+		"hold php <8.3 or",
+		"pin php 8.2",
+	} {
+		if _, err := parseConfig(strings.NewReader(bad), "test.conf"); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+
+	"suah.dev/protect"
+)
+
+// FleetHost is the report for one of the inventories given in fleet mode
+type FleetHost struct {
+	Hostname string `json:"hostname"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	Report
+}
+
+// fleetIndex is a pkgup index shared by the hosts upgrading from the same
+// mirror
+type fleetIndex struct {
+	mirror openbsd.Mirror
+	pkgs   PkgList
+
+	quirks     openbsd.Quirks
+	quirksErr  error
+	haveQuirks bool
+}
+
+// getQuirks fetches the mirror's quirks the first time they're needed
+func (i *fleetIndex) getQuirks() (openbsd.Quirks, error) {
+	if !i.haveQuirks {
+		i.haveQuirks = true
+		indexString, err := openbsd.GetIndexTxt(i.mirror)
+		if err == nil {
+			i.quirks, err = openbsd.GetQuirksFromIndex(i.mirror, indexString)
+		}
+		i.quirksErr = err
+	}
+
+	return i.quirks, i.quirksErr
+}
+
+// readInventories reads the inventories at paths; directories are searched
+// for *.json inventories
+func readInventories(paths []string) []openbsd.Inventory {
+	var files []string
+	for _, path := range paths {
+		_ = protect.Unveil(path, "r")
+		info, err := os.Stat(path)
+		checkAndExit(err)
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		checkAndExit(err)
+		files = append(files, matches...)
+	}
+
+	var inventories []openbsd.Inventory
+	for _, file := range files {
+		f, err := os.Open(file)
+		checkAndExit(err)
+		inventory, err := openbsd.ReadInventory(f)
+		f.Close()
+		if err != nil {
+			checkAndExit(fmt.Errorf("%s: %s", file, err))
+		}
+		if inventory.Hostname == "" {
+			inventory.Hostname = strings.TrimSuffix(filepath.Base(file), ".json")
+		}
+		inventories = append(inventories, inventory)
+	}
+
+	return inventories
+}
+
+// inventoryToPkgList turns an inventory into the form
+// parseLocalPkgInfoToPkgList returns
+func inventoryToPkgList(inventory openbsd.Inventory) InstalledPkgList {
+	pkgList := make(InstalledPkgList)
+	for _, p := range inventory.Packages {
+		pkg, err := p.Package()
+		checkAndExit(err)
+		installed := InstalledPkg{Package: pkg, isBranch: p.Branch, isFirmware: p.Firmware, isManual: p.Manual}
+		pkgList[pkg.Name.Stem] = append(pkgList[pkg.Name.Stem], installed)
+	}
+
+	return pkgList
+}
+
+// checkInventory finds the package upgrades of a host from its inventory
+func checkInventory(inventory openbsd.Inventory, index *fleetIndex, config Config) Report {
+	report := Report{Snapshot: inventory.Snapshot}
+
+	updateList, _, missingPkgs, _ := findUpgrades(inventoryToPkgList(inventory), index.pkgs, config, &report)
+	if len(missingPkgs) != 0 {
+		quirks, err := index.getQuirks()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to read quirks for %s: %s\n", inventory.Hostname, err)
+		} else {
+			checkQuirks(missingPkgs, index.pkgs, quirks, updateList, &report)
+		}
+	}
+	report.Command = pkgAddCommand(updateList, inventory.Snapshot)
+
+	return report
+}
+
+// getFleetIndex returns the pkgup index for the host of an inventory,
+// fetching it if it isn't in indexes yet
+func getFleetIndex(indexes map[string]*fleetIndex, inventory openbsd.Inventory) *fleetIndex {
+	sysInfo := SysInfo{arch: inventory.Arch, version: inventory.Version, snapshot: inventory.Snapshot}
+	mirror := getPackageMirror(sysInfo)
+	pkgUpMirror := getPkgUpMirror(mirror, sysInfo)
+
+	key := fmt.Sprintf("%s %s", mirror, pkgUpMirror)
+	index, ok := indexes[key]
+	if !ok {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "fetching pkgup index from %s\n", pkgUpMirror)
+		}
+		pkgs, _ := getPkgUpIndex(pkgUpMirror)
+		index = &fleetIndex{mirror: mirror, pkgs: pkgs}
+		indexes[key] = index
+	}
+
+	return index
+}
+
+// fleet reports the package upgrades of the hosts whose inventories are
+// given in args, fetching each pkgup index once
+func fleet(args []string) {
+	flagSet := flag.NewFlagSet("fleet", flag.ExitOnError)
+	flagSet.BoolVar(&cronMode, "c", false, "Cron mode (leave out hosts that are up to date)")
+	flagSet.BoolVar(&jsonOutput, "j", false, "Output JSON")
+	flagSet.BoolVar(&verbose, "v", false, "Show verbose logging information")
+	flagSet.StringVar(&configPath, "f", defaultConfigPath, "Configuration file")
+	flagSet.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: obsdpkgup fleet [-cjv] [-f config] inventory ...\n")
+		fmt.Fprintf(os.Stderr, "inventories are JSON files written by obsdpkgup export, or directories of them\n")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+	config := loadConfig()
+
+	inventories := readInventories(flagSet.Args())
+	if len(inventories) == 0 {
+		checkAndExit(fmt.Errorf("no inventories found"))
+	}
+	sort.Slice(inventories, func(i, j int) bool {
+		return inventories[i].Hostname < inventories[j].Hostname
+	})
+
+	indexes := make(map[string]*fleetIndex)
+	var hosts []FleetHost
+	for _, inventory := range inventories {
+		index := getFleetIndex(indexes, inventory)
+		hosts = append(hosts, FleetHost{
+			Hostname: inventory.Hostname,
+			Arch:     inventory.Arch,
+			Version:  inventory.Version,
+			Report:   checkInventory(inventory, index, config),
+		})
+	}
+
+	checkAndExit(writeFleet(os.Stdout, hosts))
+}
+
+// writeFleet writes the reports of hosts to w, as JSON with -j
+func writeFleet(w io.Writer, hosts []FleetHost) error {
+	if jsonOutput {
+		results := []FleetHost{}
+		for _, host := range hosts {
+			if !cronMode || host.Actionable() {
+				if host.Upgrades == nil {
+					host.Upgrades = []ReportUpgrade{}
+				}
+				results = append(results, host)
+			}
+		}
+		if cronMode && len(results) == 0 {
+			return nil
+		}
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+
+	first := true
+	for _, host := range hosts {
+		if cronMode && !host.Actionable() {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		fmt.Fprintf(w, "%s (%s, %s):\n", host.Hostname, host.Version, host.Arch)
+		host.WriteText(w, w)
+	}
+
+	return nil
+}
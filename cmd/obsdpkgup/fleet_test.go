@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+)
+
+func TestReadInventories(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"x1.json":    `{"hostname": "x1", "arch": "amd64", "version": "7.4", "packages": []}`,
+		"x2.json":    `{"arch": "arm64", "version": "7.4", "snapshot": true, "packages": []}`,
+		"notes.txt":  `not an inventory`,
+		"x3.json.gz": `not an inventory either`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inventories := readInventories([]string{dir})
+	if len(inventories) != 2 {
+		t.Fatalf("expected 2 inventories, got %+v", inventories)
+	}
+	hosts := make(map[string]openbsd.Inventory)
+	for _, inventory := range inventories {
+		hosts[inventory.Hostname] = inventory
+	}
+	// without a hostname, the file name is used
+	if hosts["x1"].Arch != "amd64" || hosts["x2"].Arch != "arm64" || !hosts["x2"].Snapshot {
+		t.Errorf("unexpected inventories %+v", inventories)
+	}
+
+	if inventories := readInventories([]string{filepath.Join(dir, "x1.json")}); len(inventories) != 1 || inventories[0].Hostname != "x1" {
+		t.Errorf("unexpected inventories %+v", inventories)
+	}
+}
+
+func TestInventoryToPkgList(t *testing.T) {
+	pkgList := inventoryToPkgList(openbsd.Inventory{Packages: []openbsd.InventoryPackage{
+		{Name: "python-3.11.6p0", Signature: "python-3.11.6p0,1", Pkgpath: "lang/python/3.11", Branch: true, Manual: true},
+		{Name: "python-3.10.13", Signature: "python-3.10.13,1", Pkgpath: "lang/python/3.10", Branch: true},
+		{Name: "iwx-firmware-20230330", Signature: "iwx-firmware-20230330", Pkgpath: "sysutils/firmware/iwx", Firmware: true},
+	}})
+	if len(pkgList) != 2 || len(pkgList["python"]) != 2 || len(pkgList["iwx-firmware"]) != 1 {
+		t.Fatalf("unexpected package list %+v", pkgList)
+	}
+	python := pkgList["python"][0]
+	if python.FullName != "python-3.11.6p0" || python.Signature != "python-3.11.6p0,1" || python.Pkgpath != "lang/python/3.11" || !python.isBranch || !python.isManual || python.isFirmware {
+		t.Errorf("unexpected package %+v", python)
+	}
+	if pkgList["python"][1].isManual || !pkgList["iwx-firmware"][0].isFirmware {
+		t.Errorf("unexpected packages %+v", pkgList)
+	}
+}
+
+func TestFleet(t *testing.T) {
+	index := &fleetIndex{pkgs: testPkgList(
+		"curl-8.5.0.tgz curl-8.5.0 net/curl",
+		"rsync-3.2.7.tgz rsync-3.2.7 net/rsync",
+	)}
+	config, err := parseConfig(strings.NewReader(""), "test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hosts []FleetHost
+	for _, inventory := range []openbsd.Inventory{
+		{Hostname: "x1", Arch: "amd64", Version: "7.4", Packages: []openbsd.InventoryPackage{
+			{Name: "curl-8.4.0", Signature: "curl-8.4.0", Pkgpath: "net/curl", Manual: true},
+			{Name: "rsync-3.2.7", Signature: "rsync-3.2.7", Pkgpath: "net/rsync", Manual: true},
+		}},
+		{Hostname: "x2", Arch: "amd64", Version: "7.4", Packages: []openbsd.InventoryPackage{
+			{Name: "rsync-3.2.7", Signature: "rsync-3.2.7", Pkgpath: "net/rsync", Manual: true},
+		}},
+	} {
+		hosts = append(hosts, FleetHost{
+			Hostname: inventory.Hostname,
+			Arch:     inventory.Arch,
+			Version:  inventory.Version,
+			Report:   checkInventory(inventory, index, config),
+		})
+	}
+	if strings.Join(hosts[0].Command, " ") != "pkg_add -u curl" || len(hosts[1].Command) != 0 {
+		t.Fatalf("unexpected reports %+v", hosts)
+	}
+
+	defer func(cron, json bool) {
+		cronMode, jsonOutput = cron, json
+	}(cronMode, jsonOutput)
+
+	cronMode, jsonOutput = true, true
+	var buf bytes.Buffer
+	if err := writeFleet(&buf, hosts); err != nil {
+		t.Fatal(err)
+	}
+	var results []FleetHost
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	// up to date hosts are left out in cron mode
+	if len(results) != 1 || results[0].Hostname != "x1" || len(results[0].Upgrades) != 1 || results[0].Upgrades[0].Available != "curl-8.5.0" {
+		t.Errorf("unexpected JSON %s", buf.String())
+	}
+
+	cronMode, jsonOutput = false, false
+	buf.Reset()
+	if err := writeFleet(&buf, hosts); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "x1 (7.4, amd64):\n") || !strings.Contains(out, "curl-8.4.0->8.5.0\n") || !strings.Contains(out, "pkg_add -u curl\n") ||
+		!strings.Contains(out, "\nx2 (7.4, amd64):\nup to date\n") {
+		t.Errorf("unexpected text output:\n%s", out)
+	}
+}
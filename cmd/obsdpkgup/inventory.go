@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+
+	"suah.dev/protect"
+)
+
+// getInventory returns the inventory of this host
+func getInventory() openbsd.Inventory {
+	hostname, err := os.Hostname()
+	checkAndExit(err)
+
+	return newInventory(hostname, getSystemInfo(), parseLocalPkgInfoToPkgList())
+}
+
+// newInventory returns the inventory of a host with the given installed
+// packages; it's what inventoryToPkgList reads back
+func newInventory(hostname string, sysInfo SysInfo, installedPkgs InstalledPkgList) openbsd.Inventory {
+	inventory := openbsd.Inventory{
+		Hostname: hostname,
+		Arch:     sysInfo.arch,
+		Version:  sysInfo.version,
+		Snapshot: sysInfo.snapshot,
+		Packages: []openbsd.InventoryPackage{},
+	}
+	for _, versions := range installedPkgs {
+		for _, pkg := range versions {
+			inventory.Packages = append(inventory.Packages, openbsd.InventoryPackage{
+				Name:      pkg.FullName,
+				Signature: pkg.Signature,
+				Pkgpath:   pkg.Pkgpath,
+				Branch:    pkg.isBranch,
+				Firmware:  pkg.isFirmware,
+				Manual:    pkg.isManual,
+			})
+		}
+	}
+	sort.Slice(inventory.Packages, func(i, j int) bool {
+		return inventory.Packages[i].Name < inventory.Packages[j].Name
+	})
+
+	return inventory
+}
+
+// export writes the inventory of this host to the file given in args, or to
+// stdout
+func export(args []string) {
+	flagSet := flag.NewFlagSet("export", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: obsdpkgup export [file]\n")
+	}
+	_ = flagSet.Parse(args)
+	if flagSet.NArg() > 1 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	b, err := json.MarshalIndent(getInventory(), "", "  ")
+	checkAndExit(err)
+	b = append(b, '\n')
+
+	if flagSet.NArg() == 0 {
+		_, err = os.Stdout.Write(b)
+		checkAndExit(err)
+		return
+	}
+	_ = protect.Unveil(flagSet.Arg(0), "rwc")
+	checkAndExit(ioutil.WriteFile(flagSet.Arg(0), b, 0644))
+}
+
+// importInventory checks an exported inventory for upgrades as if on its host
+// or, with -p, prints the pkg_add command installing its packages on a fresh
+// machine
+func importInventory(args []string) {
+	flagSet := flag.NewFlagSet("import", flag.ExitOnError)
+	install := flagSet.Bool("p", false, "Print the pkg_add command recreating the manually installed packages")
+	flagSet.BoolVar(&cronMode, "c", false, "Cron mode (only output when updates are available)")
+	flagSet.BoolVar(&jsonOutput, "j", false, "Output JSON")
+	flagSet.BoolVar(&verbose, "v", false, "Show verbose logging information")
+	flagSet.StringVar(&configPath, "f", defaultConfigPath, "Configuration file")
+	flagSet.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: obsdpkgup import [-cjpv] [-f config] inventory\n")
+		fmt.Fprintf(os.Stderr, "the inventory is a JSON file written by obsdpkgup export\n")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+	if flagSet.NArg() != 1 {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	inventories := readInventories(flagSet.Args())
+	if len(inventories) != 1 {
+		checkAndExit(fmt.Errorf("expected a single inventory in %s, found %d", flagSet.Arg(0), len(inventories)))
+	}
+	inventory := inventories[0]
+
+	if *install {
+		command, err := inventory.InstallCommand()
+		checkAndExit(err)
+		if len(command) == 0 {
+			fmt.Fprintf(os.Stderr, "no manually installed packages in %s\n", flagSet.Arg(0))
+			return
+		}
+		fmt.Printf("%s\n", shellQuote(command))
+		return
+	}
+
+	config := loadConfig()
+	report := checkInventory(inventory, getFleetIndex(make(map[string]*fleetIndex), inventory), config)
+	if jsonOutput {
+		if !cronMode || report.Actionable() {
+			checkAndExit(report.PrintJSON())
+		}
+	} else {
+		report.PrintText()
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+)
+
+func TestInventoryRoundTrip(t *testing.T) {
+	installed := make(InstalledPkgList)
+	curl := testInstalled(t, "curl-8.4.0", "curl-8.4.0,libc.97.1", "net/curl")
+	curl.isManual = true
+	python := testInstalled(t, "python-3.11.6p0", "python-3.11.6p0,1", "lang/python/3.11")
+	python.isBranch = true
+	python.isManual = true
+	nghttp2 := testInstalled(t, "nghttp2-1.57.0", "nghttp2-1.57.0", "www/nghttp2")
+	iwx := testInstalled(t, "iwx-firmware-20230330", "iwx-firmware-20230330", "sysutils/firmware/iwx")
+	iwx.isFirmware = true
+	for _, pkg := range []InstalledPkg{curl, python, nghttp2, iwx} {
+		installed[pkg.Name.Stem] = append(installed[pkg.Name.Stem], pkg)
+	}
+	sysInfo := SysInfo{arch: "amd64", version: "7.4"}
+
+	b, err := json.Marshal(newInventory("x1", sysInfo, installed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory, err := openbsd.ReadInventory(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Hostname != "x1" || inventory.Arch != "amd64" || inventory.Version != "7.4" || inventory.Snapshot {
+		t.Errorf("unexpected inventory %+v", inventory)
+	}
+	if imported := inventoryToPkgList(inventory); !reflect.DeepEqual(imported, installed) {
+		t.Errorf("expected %+v, got %+v", installed, imported)
+	}
+
+	command, err := inventory.InstallCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(command, " "); got != "pkg_add curl-- python--%3.11" {
+		t.Errorf("unexpected install command %q", got)
+	}
+}
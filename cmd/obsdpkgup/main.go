@@ -3,10 +3,11 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"regexp"
@@ -21,31 +22,26 @@ import (
 	"suah.dev/protect"
 )
 
-// PkgVer represents an individual entry in our package index
-type PkgVer struct {
-	name      string
-	fullName  string
-	version   version2.Version
-	flavor    string
-	signature string
-	pkgpath   string
-	isBranch  bool
-}
-
-func (p PkgVer) Equals(o PkgVer) bool {
-	if p.signature != o.signature {
-		return false
-	}
+// PkgList maps a package stem to its entries in our package index
+type PkgList map[string]version2.Packages
 
-	return true
+// InstalledPkg is a package from the local package database
+type InstalledPkg struct {
+	version2.Package
+	isBranch   bool
+	isFirmware bool
+	isManual   bool
+	depends    []openbsd.Depend
 }
 
-func (p PkgVer) String() string {
-	return p.fullName
-}
+// InstalledPkgList maps a package stem to its installed versions
+type InstalledPkgList map[string][]InstalledPkg
 
-// PkgList maps a package name to a list of PkgVer's
-type PkgList map[string][]PkgVer
+// Upgrade is an installed package and the package replacing it
+type Upgrade struct {
+	installed InstalledPkg
+	target    version2.Package
+}
 
 func checkAndExit(e error) {
 	if e != nil {
@@ -54,46 +50,18 @@ func checkAndExit(e error) {
 	}
 }
 
-var numRE = regexp.MustCompile(`^[0-9.]+.*$`)
-
-// returns: pkgVer struct, error
-func NewPkgVerFromString(pkgStr string) (PkgVer, error) {
-	pkgFileSlice := strings.Split(pkgStr, "-")
-	// pkgFileSlice: "[x, y, 1.2.3p4, flavor1, flavor2]"
-	// walk backwards until we find the version
-	for i := len(pkgFileSlice) - 1; i >= 0; i-- {
-		// found version!
-		if numRE.MatchString(pkgFileSlice[i]) {
-			version := version2.NewVersionFromString(pkgFileSlice[i])
-			flavor := ""
-			if len(pkgFileSlice[i:]) > 1 {
-				flavor = strings.Join(pkgFileSlice[i+1:], "-")
-			}
-			return PkgVer{
-				fullName: pkgStr,
-				version:  version,
-				flavor:   flavor,
-				name:     strings.Join(pkgFileSlice[:i], "-"),
-			}, nil
-		}
-	}
-	return PkgVer{}, fmt.Errorf("couldn't find version in pkg: %q\n", pkgStr)
-}
-
-func parseLocalPkgInfoToPkgList() PkgList {
-	pkgList := make(PkgList)
+func parseLocalPkgInfoToPkgList() InstalledPkgList {
+	pkgList := make(InstalledPkgList)
 
 	pkgDbPath := "/var/db/pkg/"
 	files, err := ioutil.ReadDir(pkgDbPath)
 	checkAndExit(err)
 
-	pkgpathRe := regexp.MustCompilePOSIX(`^@comment pkgpath=([^ ]+).*$`)
-	isBranchRe := regexp.MustCompilePOSIX(`^@option is-branch$`)
-
 	for _, file := range files {
 		pkgdir := file.Name()
-		pkgVer, err := NewPkgVerFromString(pkgdir)
+		pkg, err := version2.NewPackageFromString(pkgdir)
 		checkAndExit(err)
+		pkgVer := InstalledPkg{Package: pkg}
 
 		f, err := os.Open(fmt.Sprintf("%s%s/+CONTENTS", pkgDbPath, pkgdir))
 		checkAndExit(err)
@@ -103,14 +71,19 @@ func parseLocalPkgInfoToPkgList() PkgList {
 
 		f.Close()
 
-		pkgVer.signature = openbsd.GenerateSignatureFromContents(contents)
-		pkgpath := pkgpathRe.FindSubmatch(contents)[1]
-		pkgVer.pkgpath = string(pkgpath)
-		if isBranchRe.Match(contents) {
-			pkgVer.isBranch = true
+		plist, err := openbsd.NewPackingListFromBytes(contents)
+		if err != nil {
+			checkAndExit(fmt.Errorf("error parsing %s%s/+CONTENTS: %s", pkgDbPath, pkgdir, err))
 		}
 
-		pkgList[pkgVer.name] = append(pkgList[pkgVer.name], pkgVer)
+		pkgVer.Signature = plist.Signature()
+		pkgVer.Pkgpath = plist.Pkgpath
+		pkgVer.isBranch = plist.IsBranch()
+		pkgVer.isFirmware = plist.IsFirmware()
+		pkgVer.isManual = plist.IsManual()
+		pkgVer.depends = plist.Depends
+
+		pkgList[pkgVer.Name.Stem] = append(pkgList[pkgVer.Name.Stem], pkgVer)
 	}
 	return pkgList
 }
@@ -127,11 +100,11 @@ func parseObsdPkgUpList(pkgup string) PkgList {
 			}
 			signature := tmp[1]
 			pkgpath := tmp[2]
-			pkgVer, err := NewPkgVerFromString(pkgFile[:len(pkgFile)-4])
+			pkgVer, err := version2.NewPackageFromString(pkgFile[:len(pkgFile)-4])
 			checkAndExit(err)
-			pkgVer.signature = signature
-			pkgVer.pkgpath = pkgpath
-			pkgList[pkgVer.name] = append(pkgList[pkgVer.name], pkgVer)
+			pkgVer.Signature = signature
+			pkgVer.Pkgpath = pkgpath
+			pkgList[pkgVer.Name.Stem] = append(pkgList[pkgVer.Name.Stem], pkgVer)
 		}
 	}
 
@@ -142,6 +115,7 @@ type SysInfo struct {
 	arch     string
 	version  string
 	snapshot bool
+	kernel   openbsd.KernVersion
 }
 
 func getSystemInfo() SysInfo {
@@ -151,11 +125,19 @@ func getSystemInfo() SysInfo {
 	output, err := cmd.Output()
 	checkAndExit(err)
 
-	if strings.Contains(string(output), "-current") || strings.Contains(string(output), "-beta") || forceSnapshot {
-		sysInfo.snapshot = true
+	sysInfo.kernel, err = openbsd.NewKernVersionFromString(string(output))
+	if err == nil {
+		sysInfo.snapshot = sysInfo.kernel.IsSnapshot()
+		sysInfo.version = sysInfo.kernel.Release
+	} else if len(output) >= 11 {
+		// fall back to what we did before kern.version was parsed
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", err)
+		sysInfo.snapshot = strings.Contains(string(output), "-current") || strings.Contains(string(output), "-beta")
+		sysInfo.version = string(output[8:11])
+	} else {
+		checkAndExit(err)
 	}
-
-	sysInfo.version = string(output[8:11])
+	sysInfo.snapshot = sysInfo.snapshot || forceSnapshot
 
 	cmd = exec.Command("arch", "-s")
 	output, err = cmd.Output()
@@ -166,16 +148,56 @@ func getSystemInfo() SysInfo {
 	return sysInfo
 }
 
+// getMessages returns the +DISPLAY messages of the packages to be upgraded
+// that differ from those of the installed versions
+func getMessages(mirror openbsd.Mirror, upgrades []Upgrade) []ReportMessage {
+	var messages []ReportMessage
+	for _, upgrade := range upgrades {
+		target := upgrade.target
+		pkg, err := mirror.OpenPackage(fmt.Sprintf("%s.tgz", target.FullName))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to fetch %s: %s\n", target.FullName, err)
+			continue
+		}
+		metadata, err := openbsd.ReadPackageMetadata(pkg)
+		pkg.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to read metadata of %s: %s\n", target.FullName, err)
+			continue
+		}
+
+		display := metadata.Display()
+		if display == "" {
+			continue
+		}
+		installedDisplay, _ := ioutil.ReadFile(fmt.Sprintf("/var/db/pkg/%s/+DISPLAY", upgrade.installed.FullName))
+		if display == string(installedDisplay) {
+			continue
+		}
+		messages = append(messages, ReportMessage{Package: target.FullName, Message: strings.TrimRight(display, "\n")})
+	}
+
+	return messages
+}
+
 var protocolRe = regexp.MustCompile(`://`)
 var repeatingSlashRe = regexp.MustCompile(`/+`)
 
 func replaceMirrorVars(mirror string, sysInfo SysInfo) string {
+	return expandMirrorVars(mirror, sysInfo, true)
+}
+
+// expandMirrorVars replaces the variables in mirror. On releases, %c/packages
+// becomes %c/packages-stable if stable is set.
+func expandMirrorVars(mirror string, sysInfo SysInfo, stable bool) string {
 	mirror = strings.ReplaceAll(mirror, "%m", "/pub/OpenBSD/%c/packages/%a/")
 
 	if sysInfo.snapshot {
 		mirror = strings.ReplaceAll(mirror, "%c", "snapshots")
 	} else {
-		mirror = strings.ReplaceAll(mirror, "%c/packages", "%c/packages-stable")
+		if stable {
+			mirror = strings.ReplaceAll(mirror, "%c/packages", "%c/packages-stable")
+		}
 		mirror = strings.ReplaceAll(mirror, "%c", sysInfo.version)
 	}
 
@@ -184,48 +206,442 @@ func replaceMirrorVars(mirror string, sysInfo SysInfo) string {
 
 	// strip duplicate /'s to work around a bug on some of the mirrors
 	s := protocolRe.Split(mirror, -1)
-	s[1] = repeatingSlashRe.ReplaceAllString(s[1], "/")
+	s[len(s)-1] = repeatingSlashRe.ReplaceAllString(s[len(s)-1], "/")
 
 	mirror = strings.Join(s, "://")
 
 	return mirror
 }
 
-func getMirror() string {
-	sysInfo := getSystemInfo()
+// getPkgUpMirror returns where to find the pkgup index: PKGUP_URL if set,
+// otherwise the package mirror
+func getPkgUpMirror(mirror openbsd.Mirror, sysInfo SysInfo) openbsd.Mirror {
+	pkgUpBaseUrl := os.Getenv("PKGUP_URL")
+	if pkgUpBaseUrl == "" {
+		return mirror
+	}
+
+	return newMirror(replaceMirrorVars(fmt.Sprintf("%s/%%c/%%a/", pkgUpBaseUrl), sysInfo))
+}
+
+// getPkgUpIndex downloads and parses the pkgup index, returning the packages
+// and the quirks date it was generated from
+func getPkgUpIndex(pkgUpMirror openbsd.Mirror) (PkgList, string) {
+	pkgUpIndex, err := pkgUpMirror.OpenPackage("index.pkgup.gz")
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "unable to locate pkgup index at '%s'.\n", pkgUpMirror)
+		os.Exit(1)
+	}
+	checkAndExit(err)
+
+	r, err := gzip.NewReader(pkgUpIndex)
+	checkAndExit(err)
+	pkgUpBytes, err := ioutil.ReadAll(r)
+	checkAndExit(err)
+	pkgUpIndex.Close()
+
+	// get + check version
+	indexFormatVersionEndIndex := bytes.IndexByte(pkgUpBytes, '\n')
+	indexFormatVersionStr := string(pkgUpBytes[:indexFormatVersionEndIndex])
+	pkgUpBytes = pkgUpBytes[indexFormatVersionEndIndex+1:]
+	indexFormatVersion, err := strconv.Atoi(indexFormatVersionStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "expected index version %d, got: %s\n", currentIndexFormatVersion, indexFormatVersionStr)
+		os.Exit(1)
+	}
+
+	if indexFormatVersion != currentIndexFormatVersion {
+		fmt.Fprintf(os.Stderr, "expected index version %d, got: %d\n", currentIndexFormatVersion, indexFormatVersion)
+		if currentIndexFormatVersion < indexFormatVersion {
+			fmt.Fprintf(os.Stderr, "please update obsdpkgup and try again\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "wait for remote mirror to update to the current pkgup index format and try again later\n")
+		}
+
+		os.Exit(1)
+	}
+
+	// get quirks timestamp from pkgUp
+	quirksEndIndex := bytes.IndexByte(pkgUpBytes, '\n')
+	pkgUpQuirksDateString := string(pkgUpBytes[:quirksEndIndex])
+	pkgUpBytes = pkgUpBytes[quirksEndIndex+1:]
+
+	// now parse the actual package list
+	return parseObsdPkgUpList(string(pkgUpBytes)), pkgUpQuirksDateString
+}
+
+// isUpgrade reports whether candidate should replace the installed package:
+// either a version bump or a same-version rebuild with a different signature
+func isUpgrade(candidate version2.Package, installed InstalledPkg) bool {
+	versionComparisonResult := candidate.Name.Version.Compare(installed.Name.Version)
+	return versionComparisonResult == 1 || (versionComparisonResult == 0 && candidate.Signature != installed.Signature)
+}
+
+// findUpgrades compares the installed packages with the pkgup index, adding
+// the upgrades and held back packages to report. It returns the pkg_add
+// arguments, the upgrades, the packages missing from the index and the
+// installed firmware.
+func findUpgrades(installedPkgs InstalledPkgList, allPkgs PkgList, config Config, report *Report) (updateList map[string]bool, upgrades []Upgrade, missingPkgs, firmwarePkgs []InstalledPkg) {
+	updateList = make(map[string]bool) // this is used as a set
+
+	var sortedInstalledPkgs []string
+	for k := range installedPkgs {
+		sortedInstalledPkgs = append(sortedInstalledPkgs, k)
+	}
+	sort.Strings(sortedInstalledPkgs)
+
+	for _, name := range sortedInstalledPkgs {
+		// quirks is treated specially; don't ever try to manually update it
+		if name == "quirks" {
+			continue
+		}
+
+		// firmware comes from the firmware site, checked separately
+		if installedPkgs[name][0].isFirmware {
+			firmwarePkgs = append(firmwarePkgs, installedPkgs[name]...)
+			continue
+		}
+
+		// if package name doesn't exist in remote, check quirks for it later
+		if _, ok := allPkgs[name]; !ok {
+			missingPkgs = append(missingPkgs, installedPkgs[name]...)
+			continue
+		}
+
+		installedVersions := installedPkgs[name]
+		constraint, isHeld := config.holds[name]
+
+		// versions outside of a hold are never upgrade candidates
+		available := allPkgs[name]
+		if isHeld {
+			available = nil
+			for _, p := range allPkgs[name] {
+				if constraint.Check(p.Name.Version) {
+					available = append(available, p)
+				}
+			}
+		}
+
+		// check all versions to find upgrades
+		for _, installedVersion := range installedVersions {
+			flavor := installedVersion.Name.Flavor()
+			bestVersionMatch, ok := available.Newest(flavor, installedVersion.Pkgpath)
+
+			// did we find an upgrade?
+			ok = ok && isUpgrade(bestVersionMatch, installedVersion)
+
+			if ok {
+				var index string
+				index = name
+				if isHeld {
+					// keep pkg_add from upgrading past the hold
+					if spec, ok := constraint.PkgSpecVersion(); ok {
+						index = fmt.Sprintf("%s-%s", name, spec)
+						if flavor != "" {
+							index = fmt.Sprintf("%s-%s", index, flavor)
+						}
+					} else {
+						index = bestVersionMatch.FullName
+					}
+				}
+				if installedVersion.isBranch {
+					if branch := version2.BranchFromPkgpath(installedVersion.Pkgpath); branch != "" {
+						index = fmt.Sprintf("%s%%%s", index, branch)
+					}
+				}
+				updateList[index] = true
+				upgrades = append(upgrades, Upgrade{installed: installedVersion, target: bestVersionMatch})
+				newVersion := bestVersionMatch.Name.Version.String()
+				if flavor != "" {
+					newVersion = fmt.Sprintf("%s-%s", newVersion, flavor)
+				}
+				report.Upgrades = append(report.Upgrades, ReportUpgrade{Installed: installedVersion.FullName, Available: bestVersionMatch.FullName, Version: newVersion})
+			} else {
+				bestVersionMatch = installedVersion.Package
+			}
+
+			if isHeld {
+				heldVersion, ok := allPkgs[name].Newest(flavor, installedVersion.Pkgpath)
+				if ok && heldVersion.Name.Version.Compare(bestVersionMatch.Name.Version) == 1 {
+					report.Held = append(report.Held, ReportHeld{Installed: installedVersion.FullName, Available: heldVersion.Name.Version.String(), Hold: constraint.String()})
+				}
+			}
+		}
+	}
+
+	return updateList, upgrades, missingPkgs, firmwarePkgs
+}
+
+// checkQuirks reports the packages missing from the index that were renamed
+// or removed
+func checkQuirks(missingPkgs []InstalledPkg, allPkgs PkgList, quirks openbsd.Quirks, updateList map[string]bool, report *Report) {
+	for _, pkg := range missingPkgs {
+		if newStem, ok := quirks.Renamed(pkg.Name.Stem); ok {
+			// pkg_add follows the rename itself
+			if _, ok := allPkgs[newStem]; ok {
+				updateList[pkg.Name.Stem] = true
+			}
+			report.Replaced = append(report.Replaced, ReportReplaced{Installed: pkg.FullName, Stem: newStem})
+		} else if reason, ok := quirks.ObsoleteReason(pkg.Name.Stem); ok {
+			report.Obsolete = append(report.Obsolete, ReportObsolete{Installed: pkg.FullName, Reason: reason})
+		}
+	}
+}
+
+// pkgAddCommand returns the pkg_add invocation for updateList, if any
+func pkgAddCommand(updateList map[string]bool, snapshot bool) []string {
+	if len(updateList) == 0 {
+		return nil
+	}
+
+	command := []string{"pkg_add", "-u"}
+	if snapshot {
+		command = append(command, "-Dsnap")
+	}
+	var sortedUpdates []string
+	for k := range updateList {
+		sortedUpdates = append(sortedUpdates, k)
+	}
+	sort.Strings(sortedUpdates)
+
+	return append(command, sortedUpdates...)
+}
+
+// addDownloadSizes fills in the sizes of the upgrades' packages, as far as
+// index.txt lists them, and their total
+func addDownloadSizes(report *Report, indexString string) {
+	entries, err := openbsd.ParseIndexTxt(indexString)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to estimate the download size: %s\n", err)
+		return
+	}
+
+	// on releases, packages-stable comes first in the index
+	sizes := make(map[string]int64)
+	for _, entry := range entries {
+		if _, ok := sizes[entry.Filename]; !ok && entry.Size != -1 {
+			sizes[entry.Filename] = entry.Size
+		}
+	}
+
+	for i, upgrade := range report.Upgrades {
+		if size, ok := sizes[fmt.Sprintf("%s.tgz", upgrade.Available)]; ok {
+			report.Upgrades[i].Size = size
+			report.DownloadSize += size
+		}
+	}
+}
+
+// prefetchJobs is how many packages are downloaded at once with -p
+const prefetchJobs = 4
+
+// prefetchUpgrades downloads the packages of the upgrades into the package
+// cache, returning the cache and the packages it has
+func prefetchUpgrades(mirror openbsd.Mirror, upgrades []Upgrade) (string, []string) {
+	dir := cacheDir
+	if dir == "" {
+		dir = os.Getenv("PKG_CACHE")
+	}
+	if dir == "" {
+		checkAndExit(fmt.Errorf("no package cache to prefetch into: set PKG_CACHE or use -C"))
+	}
+	_ = protect.Unveil(dir, "rwc")
+	checkAndExit(os.MkdirAll(dir, 0755))
+
+	var names []string
+	for _, upgrade := range upgrades {
+		names = append(names, fmt.Sprintf("%s.tgz", upgrade.target.FullName))
+	}
+
+	var fetched []string
+	for i, err := range openbsd.FetchPackages(mirror, names, dir, openbsd.SignifyKeyDir, prefetchJobs) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to prefetch %s: %s\n", names[i], err)
+			continue
+		}
+		fetched = append(fetched, names[i])
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "prefetched %d of %d packages into %s\n", len(fetched), len(names), dir)
+	}
+
+	return dir, fetched
+}
+
+// prefetchCommand returns command with the package cache dir first in
+// PKG_PATH, followed by where pkg_add(1) would look otherwise
+func prefetchCommand(dir string, command []string) []string {
+	pkgPath := os.Getenv("PKG_PATH")
+	if pkgPath == "" {
+		pkgPath = "installpath"
+	}
+
+	return append([]string{"env", fmt.Sprintf("PKG_PATH=%s/:%s", strings.TrimSuffix(dir, "/"), pkgPath)}, command...)
+}
+
+// getInstallurl returns the base URL of the OpenBSD mirror from
+// /etc/installurl, falling back to the cdn
+func getInstallurl() string {
+	installurlBytes, err := ioutil.ReadFile("/etc/installurl")
+	if err == nil {
+		return strings.TrimSpace(string(installurlBytes))
+	}
 
+	return "https://cdn.openbsd.org/pub/OpenBSD"
+}
+
+func getMirror(sysInfo SysInfo, stable bool) string {
 	// TRUSTED_PKG_PATH env var is tested first
 	trustedPkgPath := os.Getenv("TRUSTED_PKG_PATH")
 	if trustedPkgPath != "" {
-		return replaceMirrorVars(trustedPkgPath, sysInfo)
+		return expandMirrorVars(trustedPkgPath, sysInfo, stable)
 	}
 
 	// PKG_PATH is tested next
 	pkgPath := os.Getenv("PKG_PATH")
 	if pkgPath != "" {
-		return replaceMirrorVars(pkgPath, sysInfo)
+		return expandMirrorVars(pkgPath, sysInfo, stable)
 	}
 
-	// next, try /etc/installurl
-	installurlBytes, err := ioutil.ReadFile("/etc/installurl")
-	if err == nil {
-		installurl := strings.TrimSpace(string(installurlBytes))
-		return replaceMirrorVars(fmt.Sprintf("%s/%%c/packages/%%a/", installurl), sysInfo)
+	// finally, use /etc/installurl or the cdn
+	return expandMirrorVars(fmt.Sprintf("%s/%%c/packages/%%a/", getInstallurl()), sysInfo, stable)
+}
+
+// newMirror returns the mirror at location, unveiling it if it's local
+func newMirror(location string) openbsd.Mirror {
+	mirror, err := openbsd.NewMirror(location)
+	checkAndExit(err)
+	if dir, ok := mirror.(*openbsd.DirMirror); ok {
+		_ = protect.Unveil(dir.Dir, "r")
+	}
+
+	return mirror
+}
+
+// getPackageMirror returns the package mirror. On releases, pkg_add(1) looks
+// in packages-stable, holding the packages updated since the release, and
+// then in the release's packages, so both are merged.
+func getPackageMirror(sysInfo SysInfo) openbsd.Mirror {
+	stable := getMirror(sysInfo, true)
+	mirror := newMirror(stable)
+	if !sysInfo.snapshot {
+		if release := getMirror(sysInfo, false); release != stable {
+			mirror = openbsd.NewMergedMirror(mirror, newMirror(release))
+		}
+	}
+
+	return mirror
+}
+
+// snapshotSlack is how much older than the snapshot the running kernel can be
+// before a sysupgrade is suggested; base and packages aren't built at the
+// same time anyway
+const snapshotSlack = 24 * time.Hour
+
+// getBaseMirror returns where the base sets of the packages in use are: next
+// to the packages of PKG_PATH (or TRUSTED_PKG_PATH) if it's laid out like
+// the OpenBSD mirrors, and otherwise on the installurl mirror, as
+// sysupgrade(8) uses. PKGUP_URL only serves the pkgup index, so it's no help.
+func getBaseMirror(sysInfo SysInfo) string {
+	if os.Getenv("TRUSTED_PKG_PATH") != "" || os.Getenv("PKG_PATH") != "" {
+		pkgMirror := getMirror(sysInfo, false)
+		if i := strings.LastIndex(pkgMirror, "/packages/"); i != -1 {
+			return fmt.Sprintf("%s/%s/", pkgMirror[:i], sysInfo.arch)
+		}
+	}
+
+	return replaceMirrorVars(fmt.Sprintf("%s/%%c/%%a/", getInstallurl()), sysInfo)
+}
+
+// getSnapshotBuildDate returns the build date of the snapshot on the base
+// mirror
+func getSnapshotBuildDate(sysInfo SysInfo) (time.Time, error) {
+	baseMirror, err := openbsd.NewMirror(getBaseMirror(sysInfo))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return openbsd.GetBuildDate(baseMirror)
+}
+
+// getFirmwareUpgrades finds newer versions of the installed firmware on the
+// firmware site
+func getFirmwareUpgrades(installed []InstalledPkg, sysInfo SysInfo) ([]Upgrade, error) {
+	firmwareMirror, err := openbsd.NewMirror(replaceMirrorVars(firmwareURL, sysInfo))
+	if err != nil {
+		return nil, err
+	}
+	if dir, ok := firmwareMirror.(*openbsd.DirMirror); ok {
+		_ = protect.Unveil(dir.Dir, "r")
+	}
+
+	available, err := openbsd.GetFirmwarePackages(firmwareMirror)
+	if err != nil {
+		return nil, err
+	}
+
+	var upgrades []Upgrade
+	for _, pkg := range installed {
+		newest, ok := available.NewestFunc(func(p version2.Package) bool {
+			return p.Name.Stem == pkg.Name.Stem
+		})
+		if ok && newest.Name.Version.Compare(pkg.Name.Version) == 1 {
+			upgrades = append(upgrades, Upgrade{installed: pkg, target: newest})
+		}
 	}
 
-	// finally, fall back to cdn
-	return replaceMirrorVars("https://cdn.openbsd.org/pub/OpenBSD/%c/packages/%a/", sysInfo)
+	return upgrades, nil
 }
 
-var pkgpathVersionRE = regexp.MustCompile(`^.*/.*/([^ ,]+).*$`)
+// getMissingSyspatches compares the syspatch directory of the installurl
+// mirror, as syspatch(8) uses, with the installed patches
+func getMissingSyspatches(sysInfo SysInfo) ([]openbsd.Syspatch, error) {
+	syspatchMirror, err := openbsd.NewMirror(replaceMirrorVars(fmt.Sprintf("%s/syspatch/%%v/%%a/", getInstallurl()), sysInfo))
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := openbsd.GetSyspatches(syspatchMirror)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := openbsd.InstalledSyspatches(openbsd.SyspatchDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return openbsd.MissingSyspatches(available, installed), nil
+}
 
 var cronMode bool
 var forceSnapshot bool
 var verbose bool
 var debug bool
-
+var configPath string
+var verifySignatures bool
+var showMessages bool
+var jsonOutput bool
+var firmwareURL string
+var maxSnapshotGap time.Duration
+var previewRelease string
+var prefetch bool
+var cacheDir string
+
+// package lines may carry more fields after the pkgpath (genpkgup adds the
+// package comment); they're ignored, so that needs no new version
 var currentIndexFormatVersion = 1
 
+// loadConfig reads the configuration file given with -f
+func loadConfig() Config {
+	if configPath != defaultConfigPath {
+		_ = protect.Unveil(configPath, "r")
+	}
+	config, err := readConfig(configPath)
+	checkAndExit(err)
+
+	return config
+}
+
 func main() {
 	start := time.Now()
 	_ = protect.Pledge("stdio unveil rpath wpath cpath flock dns inet tty proc exec")
@@ -236,84 +652,67 @@ func main() {
 	_ = protect.Unveil("/usr/bin/arch", "rx")
 	_ = protect.Unveil("/bin/ls", "rx")
 	_ = protect.Unveil("/var/db/pkg", "r")
+	_ = protect.Unveil(openbsd.SyspatchDir, "r")
+	_ = protect.Unveil(defaultConfigPath, "r")
+	_ = protect.Unveil(openbsd.SignifyKeyDir, "r")
+
+	// subcommands take their own flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "vercmp":
+			_ = protect.Pledge("stdio")
+			os.Exit(vercmp(os.Args[2:], os.Stdout, os.Stderr))
+		case "fleet":
+			fleet(os.Args[2:])
+			return
+		case "export":
+			export(os.Args[2:])
+			return
+		case "import":
+			importInventory(os.Args[2:])
+			return
+		}
+	}
 
 	flag.BoolVar(&cronMode, "c", false, "Cron mode (only output when updates are available)")
 	flag.BoolVar(&forceSnapshot, "s", false, "Force checking snapshot directory for upgrades")
 	flag.BoolVar(&verbose, "v", false, "Show verbose logging information")
 	flag.BoolVar(&debug, "d", false, "Show debug logging information")
-
-	flag.Parse()
-
-	var err error
-
-	updateList := make(map[string]bool) // this is used as a set
-
-	mirror := getMirror()
-
-	var allPkgs PkgList
-	var sysInfo SysInfo
-
-	sysInfo = getSystemInfo()
-
-	pkgUpBaseUrl := os.Getenv("PKGUP_URL")
-	var resp *http.Response
-	var pkgUpIndexUrl string
-	if pkgUpBaseUrl != "" {
-		pkgUpIndexUrl = replaceMirrorVars(fmt.Sprintf("%s/%%c/%%a/index.pkgup.gz", pkgUpBaseUrl), sysInfo)
-	} else {
-		pkgUpIndexUrl = fmt.Sprintf("%s/index.pkgup.gz", mirror)
+	flag.StringVar(&configPath, "f", defaultConfigPath, "Configuration file")
+	flag.BoolVar(&verifySignatures, "S", false, "Verify the signature of the mirror's quirks package")
+	flag.BoolVar(&showMessages, "M", false, "Show new post-install messages of packages to be upgraded")
+	flag.BoolVar(&jsonOutput, "j", false, "Output JSON")
+	flag.DurationVar(&maxSnapshotGap, "A", 0, "Refuse to suggest pkg_add when the snapshot on the mirror is this much newer than the running kernel (eg. 72h)")
+	flag.StringVar(&previewRelease, "r", "", "Preview what happens to installed packages on an upgrade to this release (eg. 7.6)")
+	flag.BoolVar(&prefetch, "p", false, "Download the upgrades into the package cache (-C or PKG_CACHE)")
+	flag.StringVar(&cacheDir, "C", "", "Package cache directory for -p (default PKG_CACHE)")
+	flag.StringVar(&firmwareURL, "F", openbsd.DefaultFirmwareURL, "Firmware URL or local directory (%c is replaced by the release or snapshots)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: obsdpkgup [flags]\n")
+		fmt.Fprintf(os.Stderr, "       obsdpkgup vercmp [-q] a b\n")
+		fmt.Fprintf(os.Stderr, "       obsdpkgup fleet [-cjv] [-f config] inventory ...\n")
+		fmt.Fprintf(os.Stderr, "       obsdpkgup export [file]\n")
+		fmt.Fprintf(os.Stderr, "       obsdpkgup import [-cjpv] [-f config] inventory\n")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	// grab pkgup index
-	var pkgUpQuirksDateString string
-	resp, err = http.Get(pkgUpIndexUrl)
-	checkAndExit(err)
-
-	var pkgUpBytes []byte
-	switch resp.StatusCode {
-	case 200:
-		// grab body
-		r, err := gzip.NewReader(resp.Body)
-		checkAndExit(err)
-		pkgUpBytes, err = ioutil.ReadAll(r)
-		checkAndExit(err)
-		resp.Body.Close()
-	case 404:
-		fmt.Fprintf(os.Stderr, "unable to locate pkgup index at '%s'.\n", pkgUpIndexUrl)
-		os.Exit(1)
-	default:
-		fmt.Fprintf(os.Stderr, "unexpected HTTP response: %d\n", resp.StatusCode)
-		os.Exit(1)
-	}
+	config := loadConfig()
 
-	// get + check version
-	indexFormatVersionEndIndex := bytes.IndexByte(pkgUpBytes, '\n')
-	indexFormatVersionStr := string(pkgUpBytes[:indexFormatVersionEndIndex])
-	pkgUpBytes = pkgUpBytes[indexFormatVersionEndIndex+1:]
-	indexFormatVersion, err := strconv.Atoi(indexFormatVersionStr)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "expected index version %d, got: %s\n", currentIndexFormatVersion, indexFormatVersionStr)
-		os.Exit(1)
-	}
+	var report Report
 
-	if indexFormatVersion != currentIndexFormatVersion {
-		fmt.Fprintf(os.Stderr, "expected index version %d, got: %d\n", currentIndexFormatVersion, indexFormatVersion)
-		if currentIndexFormatVersion < indexFormatVersion {
-			fmt.Fprintf(os.Stderr, "please update obsdpkgup and try again\n")
-		} else {
-			fmt.Fprintf(os.Stderr, "wait for remote mirror to update to the current pkgup index format and try again later\n")
-		}
+	sysInfo := getSystemInfo()
 
-		os.Exit(1)
+	if previewRelease != "" {
+		preview(previewRelease, sysInfo)
+		return
 	}
 
-	// get quirks timestamp from pkgUp
-	quirksEndIndex := bytes.IndexByte(pkgUpBytes, '\n')
-	pkgUpQuirksDateString = string(pkgUpBytes[:quirksEndIndex])
-	pkgUpBytes = pkgUpBytes[quirksEndIndex+1:]
+	mirror := getPackageMirror(sysInfo)
 
-	// now parse the actual package list
-	allPkgs = parseObsdPkgUpList(string(pkgUpBytes))
+	// grab pkgup index
+	allPkgs, pkgUpQuirksDateString := getPkgUpIndex(getPkgUpMirror(mirror, sysInfo))
 
 	// grab mirror quirks
 	indexString, err := openbsd.GetIndexTxt(mirror)
@@ -327,6 +726,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	if verifySignatures {
+		block, err := openbsd.NewSignifyBlockFromString(mirrorQuirksSignifyBlock)
+		if err == nil {
+			err = block.VerifyWithKeyDir(openbsd.SignifyKeyDir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to verify mirror quirks signature: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// and parse the quirks date
 	mirrorQuirksDateString, err := openbsd.GetSignifyTimestampFromSignifyBlock(mirrorQuirksSignifyBlock)
 	if err != nil {
@@ -352,62 +762,15 @@ func main() {
 	}
 
 	installedPkgs := parseLocalPkgInfoToPkgList()
-	var sortedInstalledPkgs []string
-	for k := range installedPkgs {
-		sortedInstalledPkgs = append(sortedInstalledPkgs, k)
-	}
-	sort.Strings(sortedInstalledPkgs)
-
-	for _, name := range sortedInstalledPkgs {
-		// quirks is treated specially; don't ever try to manually update it
-		if name == "quirks" {
-			continue
-		}
-
-		// if package name doesn't exist in remote, skip it
-		if _, ok := allPkgs[name]; !ok {
-			continue
-		}
-
-		installedVersions := installedPkgs[name]
-
-		// check all versions to find upgrades
-		for _, installedVersion := range installedVersions {
-			bestVersionMatch := installedVersion
-		NEXTVERSION:
-			for _, remoteVersion := range allPkgs[name] {
-				// verify flavor/pkgpath match first
-				if remoteVersion.flavor != installedVersion.flavor || remoteVersion.pkgpath != installedVersion.pkgpath {
-					continue NEXTVERSION
-				}
-
-				// check for version bump
-				var versionComparisonResult = bestVersionMatch.version.Compare(remoteVersion.version)
-				if versionComparisonResult == -1 {
-					bestVersionMatch = remoteVersion
-				} else if versionComparisonResult == 0 && installedVersion.signature != remoteVersion.signature {
-					// check for same-version/different signature
-					bestVersionMatch = remoteVersion
-				}
-			}
+	updateList, upgrades, missingPkgs, firmwarePkgs := findUpgrades(installedPkgs, allPkgs, config, &report)
 
-			// did we find an upgrade?
-			if !bestVersionMatch.Equals(installedVersion) {
-				var index string
-				index = name
-				if installedVersion.isBranch {
-					res := pkgpathVersionRE.FindStringSubmatch(installedVersion.pkgpath)
-					if len(res) == 2 {
-						index = fmt.Sprintf("%s%%%s", name, res[1])
-					}
-				}
-				updateList[index] = true
-				fmt.Fprintf(os.Stderr, "%s->%s", installedVersion.fullName, bestVersionMatch.version)
-				if installedVersion.flavor != "" {
-					fmt.Fprintf(os.Stderr, "-%s", installedVersion.flavor)
-				}
-				fmt.Fprintf(os.Stderr, "\n")
-			}
+	// packages missing from the index may have been renamed or removed
+	if len(missingPkgs) != 0 {
+		quirks, err := openbsd.GetQuirksFromIndex(mirror, indexString)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to read quirks: %s\n", err)
+		} else {
+			checkQuirks(missingPkgs, allPkgs, quirks, updateList, &report)
 		}
 	}
 
@@ -427,24 +790,81 @@ func main() {
 		}
 	}
 
-	if len(updateList) == 0 {
-		if !cronMode {
-			fmt.Fprintf(os.Stderr, "up to date\n")
+	addDownloadSizes(&report, indexString)
+
+	for _, pkg := range findUnneeded(installedPkgs) {
+		report.Unneeded = append(report.Unneeded, pkg.FullName)
+	}
+
+	if showMessages && len(upgrades) != 0 {
+		report.Messages = getMessages(mirror, upgrades)
+	}
+
+	// syspatches only exist for releases
+	if !sysInfo.snapshot && sysInfo.kernel.Status == "" {
+		missing, err := getMissingSyspatches(sysInfo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to check for syspatches: %s\n", err)
 		}
-	} else {
-		fmt.Fprintf(os.Stderr, "\nto upgrade:\n")
-		fmt.Printf("pkg_add -u")
-		if sysInfo.snapshot == true {
-			fmt.Printf(" -Dsnap")
+		for _, patch := range missing {
+			report.Syspatches = append(report.Syspatches, patch.String())
+		}
+	}
+
+	if len(firmwarePkgs) != 0 {
+		firmwareUpgrades, err := getFirmwareUpgrades(firmwarePkgs, sysInfo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to check for firmware updates: %s\n", err)
+		}
+		var drivers []string
+		for _, upgrade := range firmwareUpgrades {
+			report.Firmware = append(report.Firmware, ReportUpgrade{Installed: upgrade.installed.FullName, Available: upgrade.target.FullName, Version: upgrade.target.Name.Version.String()})
+			drivers = append(drivers, openbsd.FirmwareDriver(upgrade.target.Name.Stem))
+		}
+		if len(drivers) != 0 {
+			report.FirmwareCommand = append([]string{"fw_update"}, drivers...)
+		}
+	}
+
+	report.Snapshot = sysInfo.snapshot
+	refusePkgAdd := false
+	if sysInfo.snapshot && sysInfo.kernel.BuildDate.IsZero() {
+		fmt.Fprintf(os.Stderr, "WARNING: unknown kernel build date, not checking it against the snapshot\n")
+	} else if sysInfo.snapshot {
+		snapshotBuild, err := getSnapshotBuildDate(sysInfo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: unable to check the snapshot build date: %s\n", err)
+		} else {
+			gap := snapshotBuild.Sub(sysInfo.kernel.BuildDate)
+			report.SysupgradeNeeded = gap > snapshotSlack
+			// -A may well be stricter than the slack
+			refusePkgAdd = maxSnapshotGap != 0 && gap > maxSnapshotGap
+			if report.SysupgradeNeeded || refusePkgAdd {
+				report.KernelBuild = sysInfo.kernel.BuildDate.UTC().Format(time.RFC3339)
+				report.SnapshotBuild = snapshotBuild.Format(time.RFC3339)
+			}
 		}
-		var sortedUpdates []string
-		for k := range updateList {
-			sortedUpdates = append(sortedUpdates, k)
+	}
+
+	if len(updateList) != 0 && refusePkgAdd {
+		report.Refused = true
+	} else {
+		report.Command = pkgAddCommand(updateList, sysInfo.snapshot)
+	}
+
+	if prefetch && len(report.Command) != 0 {
+		var dir string
+		dir, report.Prefetched = prefetchUpgrades(mirror, upgrades)
+		if len(report.Prefetched) != 0 {
+			report.PrefetchCommand = prefetchCommand(dir, report.Command)
 		}
-		sort.Strings(sortedUpdates)
-		for _, p := range sortedUpdates {
-			fmt.Printf(" %s", p)
+	}
+
+	if jsonOutput {
+		if !cronMode || report.Actionable() {
+			checkAndExit(report.PrintJSON())
 		}
-		fmt.Printf("\n")
+	} else {
+		report.PrintText()
 	}
 }
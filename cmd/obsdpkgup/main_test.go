@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	version2 "github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+func testPkgList(lines ...string) PkgList {
+	return parseObsdPkgUpList(strings.Join(lines, "\n"))
+}
+
+func testInstalled(t *testing.T, name, signature, pkgpath string) InstalledPkg {
+	pkg, err := version2.NewPackageFromString(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.Signature = signature
+	pkg.Pkgpath = pkgpath
+
+	return InstalledPkg{Package: pkg}
+}
+
+func TestFindUpgradesHolds(t *testing.T) {
+	allPkgs := testPkgList(
+		"postgresql-server-15.5.tgz postgresql-server-15.5 databases/postgresql,-server",
+		"postgresql-server-16.1.tgz postgresql-server-16.1 databases/postgresql,-server",
+		"php-8.2.13.tgz php-8.2.13 lang/php/8.2",
+		"php-8.3.0.tgz php-8.3.0 lang/php/8.2",
+		"curl-8.5.0.tgz curl-8.5.0 net/curl",
+	)
+	installed := make(InstalledPkgList)
+	for _, pkg := range []InstalledPkg{
+		testInstalled(t, "postgresql-server-15.4", "postgresql-server-15.4", "databases/postgresql,-server"),
+		testInstalled(t, "php-8.2.12", "php-8.2.12", "lang/php/8.2"),
+		testInstalled(t, "curl-8.4.0", "curl-8.4.0", "net/curl"),
+	} {
+		installed[pkg.Name.Stem] = append(installed[pkg.Name.Stem], pkg)
+	}
+
+	config, err := parseConfig(strings.NewReader("hold postgresql-server >=15 and <16\nhold php <8.3 or >=9\n"), "test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report Report
+	updateList, upgrades, missing, _ := findUpgrades(installed, allPkgs, config, &report)
+	if len(upgrades) != 3 || len(missing) != 0 {
+		t.Fatalf("unexpected upgrades %v, missing %v", upgrades, missing)
+	}
+
+	// one alternative goes into the spec, several pin the exact package
+	command := pkgAddCommand(updateList, false)
+	if got := strings.Join(command, " "); got != "pkg_add -u curl php-8.2.13 postgresql-server->=15,<16" {
+		t.Errorf("unexpected command %q", got)
+	}
+	if got := shellQuote(command); got != "pkg_add -u curl php-8.2.13 'postgresql-server->=15,<16'" {
+		t.Errorf("unexpected quoted command %q", got)
+	}
+
+	if len(report.Held) != 2 || report.Held[0].Available != "8.3.0" || report.Held[1].Available != "16.1" {
+		t.Errorf("unexpected held packages %+v", report.Held)
+	}
+	for _, upgrade := range report.Upgrades {
+		if upgrade.Available == "postgresql-server-16.1" || upgrade.Available == "php-8.3.0" {
+			t.Errorf("upgraded past a hold: %+v", upgrade)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote([]string{"pkg_add", "-u", "python%3.11", "a'b", ""}); got != `pkg_add -u python%3.11 'a'\''b' ''` {
+		t.Errorf("unexpected quoting %s", got)
+	}
+}
+
+func TestGetBaseMirror(t *testing.T) {
+	sysInfo := SysInfo{arch: "amd64", version: "7.6", snapshot: true}
+	installurl := replaceMirrorVars(getInstallurl()+"/%c/%a/", sysInfo)
+	tests := []struct {
+		pkgPath, pkgUpURL string
+		expected          string
+	}{
+		{"https://mirror.example.org/pub/OpenBSD/%c/packages/%a/", "", "https://mirror.example.org/pub/OpenBSD/snapshots/amd64/"},
+		{"/var/mirror/%c/packages/%a", "https://pkgup.example.org", "/var/mirror/snapshots/amd64/"},
+		// not laid out like a mirror; PKGUP_URL has no base sets either
+		{"/var/pkgs/", "https://pkgup.example.org", installurl},
+		{"", "https://pkgup.example.org", installurl},
+	}
+	for _, test := range tests {
+		t.Setenv("TRUSTED_PKG_PATH", "")
+		t.Setenv("PKG_PATH", test.pkgPath)
+		t.Setenv("PKGUP_URL", test.pkgUpURL)
+		if got := getBaseMirror(sysInfo); got != test.expected {
+			t.Errorf("PKG_PATH=%s PKGUP_URL=%s: expected %s, got %s", test.pkgPath, test.pkgUpURL, test.expected, got)
+		}
+	}
+}
+
+func TestPrefetchCommand(t *testing.T) {
+	command := []string{"pkg_add", "-u", "curl"}
+
+	t.Setenv("PKG_PATH", "")
+	report := Report{Command: command, Prefetched: []string{"curl-8.5.0.tgz"}, PrefetchCommand: prefetchCommand("/var/cache/pkg/", command)}
+	var w, cmdW bytes.Buffer
+	report.WriteText(&w, &cmdW)
+	if got := cmdW.String(); got != "env PKG_PATH=/var/cache/pkg/:installpath pkg_add -u curl\n" {
+		t.Errorf("unexpected command %q", got)
+	}
+
+	t.Setenv("PKG_PATH", "https://mirror.example.org/pub/OpenBSD/%c/packages/%a/")
+	if got := shellQuote(prefetchCommand("/var/cache/pkg", command)); got != "env PKG_PATH=/var/cache/pkg/:https://mirror.example.org/pub/OpenBSD/%c/packages/%a/ pkg_add -u curl" {
+		t.Errorf("unexpected command %q", got)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+)
+
+// Preview is what would happen to the installed packages on an upgrade to
+// another release
+type Preview struct {
+	Release   string           `json:"release"`
+	Upgrades  []ReportUpgrade  `json:"upgrades"`
+	Removed   []PreviewRemoved `json:"removed"`
+	Changed   []PreviewChanged `json:"changed"`
+	Unchanged int              `json:"unchanged"`
+}
+
+// PreviewRemoved is an installed package the release doesn't have
+type PreviewRemoved struct {
+	Installed string `json:"installed"`
+	Reason    string `json:"reason,omitempty"` // from quirks, if known
+}
+
+// PreviewChanged is an installed package whose flavor or pkgpath isn't in
+// the release; pkg_add won't upgrade it without help
+type PreviewChanged struct {
+	Installed  string   `json:"installed"`
+	Pkgpath    string   `json:"pkgpath"`
+	Candidates []string `json:"candidates"` // "name (pkgpath)"
+}
+
+var releaseRe = regexp.MustCompile(`^\d+\.\d+$`)
+
+// preview evaluates the installed packages against the pkgup index of the
+// given release without changing anything
+func preview(release string, sysInfo SysInfo) {
+	if !releaseRe.MatchString(release) {
+		checkAndExit(fmt.Errorf("invalid release %q, expected eg. 7.6", release))
+	}
+
+	target := sysInfo
+	target.version = release
+	target.snapshot = false
+
+	mirror := getPackageMirror(target)
+	allPkgs, _ := getPkgUpIndex(getPkgUpMirror(mirror, target))
+
+	// quirks only explain removals, so do without them if need be
+	var quirks openbsd.Quirks
+	indexString, err := openbsd.GetIndexTxt(mirror)
+	if err == nil {
+		quirks, err = openbsd.GetQuirksFromIndex(mirror, indexString)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to read quirks for %s: %s\n", release, err)
+	}
+
+	p := previewPackages(release, parseLocalPkgInfoToPkgList(), allPkgs, quirks)
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		checkAndExit(enc.Encode(p))
+	} else {
+		p.WriteText(os.Stdout)
+	}
+}
+
+func previewPackages(release string, installedPkgs InstalledPkgList, allPkgs PkgList, quirks openbsd.Quirks) Preview {
+	p := Preview{
+		Release:  release,
+		Upgrades: []ReportUpgrade{},
+		Removed:  []PreviewRemoved{},
+		Changed:  []PreviewChanged{},
+	}
+
+	var stems []string
+	for stem := range installedPkgs {
+		stems = append(stems, stem)
+	}
+	sort.Strings(stems)
+
+	for _, stem := range stems {
+		for _, installed := range installedPkgs[stem] {
+			if stem == "quirks" || installed.isFirmware {
+				continue
+			}
+
+			available, ok := allPkgs[stem]
+			if !ok {
+				removed := PreviewRemoved{Installed: installed.FullName}
+				if newStem, ok := quirks.Renamed(stem); ok {
+					removed.Reason = fmt.Sprintf("replaced by %s", newStem)
+				} else if reason, ok := quirks.ObsoleteReason(stem); ok {
+					removed.Reason = reason
+				}
+				p.Removed = append(p.Removed, removed)
+				continue
+			}
+
+			flavor := installed.Name.Flavor()
+			candidate, ok := available.Newest(flavor, installed.Pkgpath)
+			if !ok {
+				changed := PreviewChanged{Installed: installed.FullName, Pkgpath: installed.Pkgpath}
+				for _, pkg := range available {
+					changed.Candidates = append(changed.Candidates, fmt.Sprintf("%s (%s)", pkg.FullName, pkg.Pkgpath))
+				}
+				sort.Strings(changed.Candidates)
+				p.Changed = append(p.Changed, changed)
+				continue
+			}
+
+			if !isUpgrade(candidate, installed) {
+				p.Unchanged++
+				continue
+			}
+			newVersion := candidate.Name.Version.String()
+			if flavor != "" {
+				newVersion = fmt.Sprintf("%s-%s", newVersion, flavor)
+			}
+			p.Upgrades = append(p.Upgrades, ReportUpgrade{Installed: installed.FullName, Available: candidate.FullName, Version: newVersion})
+		}
+	}
+
+	return p
+}
+
+// WriteText writes the preview to w
+func (p Preview) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "upgrading to %s:\n", p.Release)
+
+	if len(p.Upgrades) != 0 {
+		fmt.Fprintf(w, "\nwill upgrade:\n")
+		for _, upgrade := range p.Upgrades {
+			fmt.Fprintf(w, "%s->%s\n", upgrade.Installed, upgrade.Version)
+		}
+	}
+
+	if len(p.Removed) != 0 {
+		fmt.Fprintf(w, "\nnot in %s:\n", p.Release)
+		for _, removed := range p.Removed {
+			if removed.Reason != "" {
+				fmt.Fprintf(w, "%s (%s)\n", removed.Installed, removed.Reason)
+			} else {
+				fmt.Fprintf(w, "%s\n", removed.Installed)
+			}
+		}
+	}
+
+	if len(p.Changed) != 0 {
+		fmt.Fprintf(w, "\nflavor or pkgpath changes:\n")
+		for _, changed := range p.Changed {
+			fmt.Fprintf(w, "%s (%s) -> %s\n", changed.Installed, changed.Pkgpath, strings.Join(changed.Candidates, ", "))
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d packages unchanged\n", p.Unchanged)
+}
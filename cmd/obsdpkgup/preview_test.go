@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+)
+
+func TestPreviewPackages(t *testing.T) {
+	allPkgs := testPkgList(
+		"curl-8.5.0.tgz curl-8.5.0 net/curl",
+		"rsync-3.2.7.tgz rsync-3.2.7 net/rsync",
+		"python-3.11.7.tgz python-3.11.7 lang/python/3.11",
+	)
+	installed := make(InstalledPkgList)
+	for _, pkg := range []InstalledPkg{
+		testInstalled(t, "curl-8.4.0", "curl-8.4.0", "net/curl"),
+		testInstalled(t, "rsync-3.2.7", "rsync-3.2.7", "net/rsync"),
+		testInstalled(t, "python-3.10.13", "python-3.10.13", "lang/python/3.10"),
+		testInstalled(t, "oldtool-1.0", "oldtool-1.0", "misc/oldtool"),
+		testInstalled(t, "foo-1.0", "foo-1.0", "misc/foo"),
+		testInstalled(t, "baz-1.0", "baz-1.0", "misc/baz"),
+	} {
+		installed[pkg.Name.Stem] = append(installed[pkg.Name.Stem], pkg)
+	}
+	quirks := openbsd.Quirks{
+		Obsolete:         map[string]int{"oldtool": 0},
+		ObsoleteMessages: []string{"gone upstream"},
+		StemExtensions:   map[string]string{"foo": "bar"},
+	}
+
+	var buf bytes.Buffer
+	previewPackages("7.6", installed, allPkgs, quirks).WriteText(&buf)
+	expected := `upgrading to 7.6:
+
+will upgrade:
+curl-8.4.0->8.5.0
+
+not in 7.6:
+baz-1.0
+foo-1.0 (replaced by bar)
+oldtool-1.0 (gone upstream)
+
+flavor or pkgpath changes:
+python-3.10.13 (lang/python/3.10) -> python-3.11.7 (lang/python/3.11)
+
+1 packages unchanged
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected preview:\n%s", buf.String())
+	}
+}
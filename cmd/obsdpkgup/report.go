@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Report is what a run found, printed as text or, with -j, as JSON
+type Report struct {
+	Snapshot   bool             `json:"snapshot"`
+	Upgrades   []ReportUpgrade  `json:"upgrades"`
+	Replaced   []ReportReplaced `json:"replaced,omitempty"`
+	Held       []ReportHeld     `json:"held,omitempty"`
+	Obsolete   []ReportObsolete `json:"obsolete,omitempty"`
+	Unneeded   []string         `json:"unneeded,omitempty"` // dependencies nothing needs anymore
+	Messages   []ReportMessage  `json:"messages,omitempty"`
+	Syspatches []string         `json:"missing_syspatches,omitempty"`
+	Firmware   []ReportUpgrade  `json:"firmware,omitempty"`
+	Command    []string         `json:"command,omitempty"` // pkg_add invocation
+
+	DownloadSize int64    `json:"download_size,omitempty"` // bytes, of the upgrades index.txt lists
+	Prefetched   []string `json:"prefetched,omitempty"`    // packages downloaded into the cache (-p)
+
+	PrefetchCommand []string `json:"prefetch_command,omitempty"` // Command installing from the cache first (-p)
+
+	FirmwareCommand []string `json:"firmware_command,omitempty"` // fw_update invocation
+
+	// set when the running kernel is older than the snapshot on the mirror
+	SysupgradeNeeded bool   `json:"sysupgrade_needed,omitempty"`
+	KernelBuild      string `json:"kernel_build,omitempty"`
+	SnapshotBuild    string `json:"snapshot_build,omitempty"`
+	Refused          bool   `json:"refused,omitempty"` // no pkg_add command because of the gap (-A)
+}
+
+type ReportUpgrade struct {
+	Installed string `json:"installed"`
+	Available string `json:"available"`
+	Version   string `json:"version"` // version and flavor of Available
+	Size      int64  `json:"size,omitempty"`
+}
+
+type ReportReplaced struct {
+	Installed string `json:"installed"`
+	Stem      string `json:"replaced_by"`
+}
+
+type ReportHeld struct {
+	Installed string `json:"installed"`
+	Available string `json:"available"` // newest version outside of the hold
+	Hold      string `json:"hold"`
+}
+
+type ReportObsolete struct {
+	Installed string `json:"installed"`
+	Reason    string `json:"reason"`
+}
+
+type ReportMessage struct {
+	Package string `json:"package"`
+	Message string `json:"message"`
+}
+
+// shellQuote joins a command's arguments for sh(1), quoting those with
+// special characters such as the "<" and ">" of held package specs
+func shellQuote(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "" && strings.Trim(arg, shellSafe) == "" {
+			quoted = append(quoted, arg)
+			continue
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-"
+
+// formatSize formats a size in bytes like ls -h, eg. "1.2M"
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Actionable reports whether there's anything to install
+func (r Report) Actionable() bool {
+	return len(r.Command) != 0 || len(r.Syspatches) != 0 || len(r.FirmwareCommand) != 0 || r.Refused
+}
+
+func (r Report) PrintJSON() error {
+	if r.Upgrades == nil {
+		r.Upgrades = []ReportUpgrade{}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// PrintText prints the report to stderr and the upgrade command, if any, to
+// stdout
+func (r Report) PrintText() {
+	r.WriteText(os.Stderr, os.Stdout)
+}
+
+// WriteText writes the report to w and the commands to cmdW
+func (r Report) WriteText(w, cmdW io.Writer) {
+	for _, upgrade := range r.Upgrades {
+		if upgrade.Size != 0 {
+			fmt.Fprintf(w, "%s->%s (%s)\n", upgrade.Installed, upgrade.Version, formatSize(upgrade.Size))
+		} else {
+			fmt.Fprintf(w, "%s->%s\n", upgrade.Installed, upgrade.Version)
+		}
+	}
+	for _, replaced := range r.Replaced {
+		fmt.Fprintf(w, "%s was replaced by %s\n", replaced.Installed, replaced.Stem)
+	}
+
+	showDetails := !cronMode || r.Actionable()
+
+	if len(r.Held) != 0 && showDetails {
+		fmt.Fprintf(w, "\nheld back:\n")
+		for _, held := range r.Held {
+			fmt.Fprintf(w, "%s (%s available, hold: %s)\n", held.Installed, held.Available, held.Hold)
+		}
+	}
+
+	if len(r.Obsolete) != 0 && showDetails {
+		fmt.Fprintf(w, "\nobsolete:\n")
+		for _, obsolete := range r.Obsolete {
+			fmt.Fprintf(w, "%s is obsolete and will be removed (%s)\n", obsolete.Installed, obsolete.Reason)
+		}
+	}
+
+	if len(r.Unneeded) != 0 && showDetails {
+		fmt.Fprintf(w, "\nno longer needed (pkg_delete -a removes them):\n")
+		for _, pkg := range r.Unneeded {
+			fmt.Fprintf(w, "%s\n", pkg)
+		}
+	}
+
+	if len(r.Messages) != 0 {
+		fmt.Fprintf(w, "\nmessages:\n")
+		for _, message := range r.Messages {
+			fmt.Fprintf(w, "%s:\n%s\n", message.Package, message.Message)
+		}
+	}
+
+	if len(r.Syspatches) != 0 {
+		fmt.Fprintf(w, "\nmissing syspatches (run syspatch to install them):\n")
+		for _, patch := range r.Syspatches {
+			fmt.Fprintf(w, "%s\n", patch)
+		}
+	}
+
+	if len(r.FirmwareCommand) != 0 {
+		fmt.Fprintf(w, "\nfirmware:\n")
+		for _, firmware := range r.Firmware {
+			fmt.Fprintf(w, "%s->%s\n", firmware.Installed, firmware.Version)
+		}
+		fmt.Fprintf(cmdW, "%s\n", shellQuote(r.FirmwareCommand))
+	}
+
+	if r.SysupgradeNeeded {
+		fmt.Fprintf(w, "\nWARNING: the running kernel (built %s) is older than the snapshot on the mirror (built %s).\n", r.KernelBuild, r.SnapshotBuild)
+		fmt.Fprintf(w, "run sysupgrade -s before upgrading packages\n")
+	}
+	if r.Refused {
+		fmt.Fprintf(w, "not suggesting pkg_add: the snapshot on the mirror (built %s) is more than %s newer than the running kernel (built %s)\n", r.SnapshotBuild, maxSnapshotGap, r.KernelBuild)
+	}
+
+	if len(r.Prefetched) != 0 {
+		fmt.Fprintf(w, "\nprefetched %d packages\n", len(r.Prefetched))
+	}
+
+	command := r.Command
+	if len(r.PrefetchCommand) != 0 {
+		command = r.PrefetchCommand
+	}
+	if len(command) == 0 {
+		if !cronMode && !r.Actionable() {
+			fmt.Fprintf(w, "up to date\n")
+		}
+	} else if r.DownloadSize != 0 {
+		fmt.Fprintf(w, "\nto upgrade (about %s to download):\n", formatSize(r.DownloadSize))
+		fmt.Fprintf(cmdW, "%s\n", shellQuote(command))
+	} else {
+		fmt.Fprintf(w, "\nto upgrade:\n")
+		fmt.Fprintf(cmdW, "%s\n", shellQuote(command))
+	}
+}
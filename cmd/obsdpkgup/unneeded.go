@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+	version2 "github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+var dependStemRe = regexp.MustCompile(`^(.*?)-(?:[<>=*\d-]|$)`)
+
+// dependSpecs parses the patterns of a package's dependencies; a pattern may
+// list alternatives separated by "|"
+func dependSpecs(depends []openbsd.Depend) [][]version2.PkgSpec {
+	var specs [][]version2.PkgSpec
+	for _, depend := range depends {
+		var alternatives []version2.PkgSpec
+		for _, pattern := range strings.Split(depend.Pattern, "|") {
+			spec, err := version2.NewPkgSpecFromString(pattern)
+			if err != nil {
+				spec = fallbackSpec(pattern, depend.Default)
+				if debug {
+					fmt.Fprintf(os.Stderr, "%s, keeping anything matching %s\n", err, spec)
+				}
+			}
+			alternatives = append(alternatives, spec)
+		}
+		specs = append(specs, alternatives)
+	}
+
+	return specs
+}
+
+// fallbackSpec returns a spec matching every version and flavor of the stem
+// of a pattern that doesn't parse, so that nothing it may depend on is
+// reported as unneeded. Failing that, the stem of the dependency's default
+// package is used and, as a last resort, a spec matching everything.
+func fallbackSpec(pattern, defaultName string) version2.PkgSpec {
+	stem := pattern
+	if i := strings.LastIndex(stem, "%"); i != -1 {
+		stem = stem[:i]
+	}
+	if m := dependStemRe.FindStringSubmatch(stem); m != nil {
+		stem = m[1]
+	}
+	if spec, err := version2.NewPkgSpecFromString(stem); err == nil && stem != "" {
+		return spec
+	}
+
+	if name, err := version2.NewPkgNameFromString(defaultName); err == nil {
+		if spec, err := version2.NewPkgSpecFromString(name.Stem); err == nil {
+			return spec
+		}
+	}
+
+	return version2.PkgSpec{Stem: "*"}
+}
+
+// findUnneeded returns the packages that were installed as dependencies but
+// that no remaining package depends on anymore, directly or through other
+// such packages: what pkg_delete -a would remove
+func findUnneeded(installedPkgs InstalledPkgList) []InstalledPkg {
+	remaining := make(map[string]InstalledPkg) // full name -> package
+	specs := make(map[string][][]version2.PkgSpec)
+	for _, versions := range installedPkgs {
+		for _, pkg := range versions {
+			remaining[pkg.FullName] = pkg
+			specs[pkg.FullName] = dependSpecs(pkg.depends)
+		}
+	}
+
+	var unneeded []InstalledPkg
+	for {
+		needed := make(map[string]bool)
+		for name := range remaining {
+			for _, alternatives := range specs[name] {
+				for _, spec := range alternatives {
+					for depName, dep := range remaining {
+						if depName != name && spec.MatchBranch(dep.Name, dep.Pkgpath) {
+							needed[depName] = true
+						}
+					}
+				}
+			}
+		}
+
+		// removing packages may leave more of them unneeded, so go on
+		// until nothing changes
+		var removed []string
+		for name, pkg := range remaining {
+			if pkg.isManual || pkg.isFirmware || pkg.Name.Stem == "quirks" || needed[name] {
+				continue
+			}
+			removed = append(removed, name)
+		}
+		if len(removed) == 0 {
+			break
+		}
+		for _, name := range removed {
+			unneeded = append(unneeded, remaining[name])
+			delete(remaining, name)
+		}
+	}
+
+	sort.Slice(unneeded, func(i, j int) bool {
+		return unneeded[i].FullName < unneeded[j].FullName
+	})
+
+	return unneeded
+}
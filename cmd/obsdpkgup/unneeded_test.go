@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd"
+)
+
+func TestFindUnneeded(t *testing.T) {
+	type pkg struct {
+		name, pkgpath string
+		manual        bool
+		depends       []string // patterns
+	}
+	tests := []struct {
+		name     string
+		pkgs     []pkg
+		expected string
+	}{
+		{"manual roots are kept", []pkg{
+			{"curl-8.4.0", "net/curl", true, nil},
+		}, ""},
+		{"chains", []pkg{
+			{"vim-9.0.2100", "editors/vim", true, []string{"gettext-runtime-*"}},
+			{"gettext-runtime-0.22.3", "devel/gettext,-runtime", false, []string{"libiconv-*"}},
+			{"libiconv-1.17", "converters/libiconv", false, nil},
+			// left over from a removed package, along with its dependency
+			{"gtk+3-3.24.38", "x11/gtk+3", false, []string{"cairo-*"}},
+			{"cairo-1.18.0", "graphics/cairo", false, []string{"libiconv-*"}},
+		}, "cairo-1.18.0 gtk+3-3.24.38"},
+		{"alternatives", []pkg{
+			{"mutt-2.2.12", "mail/mutt", true, []string{"gnupg->=2.4|gnupg2-*"}},
+			{"gnupg-2.2.41", "security/gnupg", false, nil},
+			{"gnupg2-2.2.41", "security/gnupg2", false, nil},
+		}, "gnupg-2.2.41"},
+		{"branches", []pkg{
+			{"py3-requests-2.31.0", "www/py-requests,python3", true, []string{"python->=3.11,<3.12%3.11"}},
+			{"python-3.11.6", "lang/python/3.11", false, nil},
+			{"python-3.10.13", "lang/python/3.10", false, nil},
+		}, "python-3.10.13"},
+		{"unparseable patterns keep the stem", []pkg{
+			{"foo-1.0", "misc/foo", true, []string{"libbar->=1.0,<<2|libbaz-1.["}},
+			{"libbar-1.5", "devel/libbar", false, nil},
+			{"libbar-2.5-debug", "devel/libbar,debug", false, nil},
+			{"libbaz-1.0", "devel/libbaz", false, nil},
+			{"libqux-1.0", "devel/libqux", false, nil},
+		}, "libqux-1.0"},
+		{"quirks is kept", []pkg{
+			{"quirks-7.14", "devel/quirks", false, nil},
+		}, ""},
+	}
+
+	for _, test := range tests {
+		installed := make(InstalledPkgList)
+		for _, p := range test.pkgs {
+			pkg := testInstalled(t, p.name, p.name, p.pkgpath)
+			pkg.isManual = p.manual
+			for _, pattern := range p.depends {
+				pkg.depends = append(pkg.depends, openbsd.Depend{Pattern: pattern})
+			}
+			installed[pkg.Name.Stem] = append(installed[pkg.Name.Stem], pkg)
+		}
+
+		var names []string
+		for _, pkg := range findUnneeded(installed) {
+			names = append(names, pkg.FullName)
+		}
+		if got := strings.Join(names, " "); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestFallbackSpec(t *testing.T) {
+	tests := []struct {
+		pattern, defaultName string
+		expected             string
+	}{
+		{"libbar->=1.0,<<2", "", "libbar"},
+		{"py3-foo-1.[%3.11", "", "py3-foo"},
+		{"[", "libbaz-1.0", "libbaz"},
+		{"[", "", "*"},
+	}
+	for _, test := range tests {
+		if spec := fallbackSpec(test.pattern, test.defaultName); spec.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.pattern, test.expected, spec)
+		}
+	}
+}
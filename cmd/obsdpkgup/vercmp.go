@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	version2 "github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+func printPkgNameComponents(w io.Writer, name string, p version2.PkgName) {
+	fmt.Fprintf(w, "%s: stem=%s version=%s dewey=%s suffix=%s suffixvalue=%s p=%d v=%d flavor=%s\n",
+		name, p.Stem, p.Version, strings.Join(p.Version.Dewey.Deweys, "."),
+		p.Version.Dewey.Suffix, p.Version.Dewey.SuffixValue, p.Version.P, p.Version.V, p.Flavor())
+}
+
+// vercmp implements the "vercmp" subcommand: compare two package names or
+// bare version strings using packages-specs(7) ordering. It returns the exit
+// status: 1 for names that can't be compared, 2 for bad usage.
+func vercmp(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("vercmp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	quiet := fs.Bool("q", false, "Only print the comparison result (-1, 0 or 1)")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: obsdpkgup vercmp [-q] a b\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	a, err := version2.NewPkgNameFromString(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+	b, err := version2.NewPkgNameFromString(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+
+	// a bare version can be compared with anything
+	if a.Stem != "" && b.Stem != "" && a.Stem != b.Stem {
+		fmt.Fprintf(stderr, "can't compare versions of different stems (%q, %q)\n", a.Stem, b.Stem)
+		return 1
+	}
+
+	res := a.Version.Compare(b.Version)
+
+	if *quiet {
+		fmt.Fprintln(stdout, res)
+		return 0
+	}
+
+	printPkgNameComponents(stdout, fs.Arg(0), a)
+	printPkgNameComponents(stdout, fs.Arg(1), b)
+
+	op := "="
+	if res < 0 {
+		op = "<"
+	} else if res > 0 {
+		op = ">"
+	}
+	fmt.Fprintf(stdout, "%s %s %s\n", fs.Arg(0), op, fs.Arg(1))
+
+	return 0
+}
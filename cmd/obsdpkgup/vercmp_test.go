@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVercmp(t *testing.T) {
+	tests := []struct {
+		args   []string
+		status int
+		out    string // last line of stdout
+	}{
+		{[]string{"1.0", "1.0p0"}, 0, "1.0 < 1.0p0"},
+		{[]string{"1.10", "1.9"}, 0, "1.10 > 1.9"},
+		{[]string{"1.0rc2", "1.0"}, 0, "1.0rc2 < 1.0"},
+		{[]string{"foo-1.0rc2", "foo-1.0p1"}, 0, "foo-1.0rc2 < foo-1.0p1"},
+		{[]string{"vim-9.0.2100-no_x11", "vim-9.0.2100-gtk3"}, 0, "vim-9.0.2100-no_x11 = vim-9.0.2100-gtk3"},
+		{[]string{"foo-1.0", "1.1"}, 0, "foo-1.0 < 1.1"},
+		{[]string{"-q", "1.0", "1.0p0"}, 0, "-1"},
+		{[]string{"-q", "1.0v1", "2.0"}, 0, "1"},
+		{[]string{"-q", "foo-1.0", "foo-1.0"}, 0, "0"},
+		{[]string{"foo-1.0", "bar-1.1"}, 1, ""},
+		{[]string{"-q", "foo-1.0", "bar-1.1"}, 1, ""},
+		{[]string{"foo", "foo-1.0"}, 1, ""},
+		{[]string{"1.0"}, 2, ""},
+		{[]string{"-x", "1.0", "1.1"}, 2, ""},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		status := vercmp(test.args, &stdout, &stderr)
+		if status != test.status {
+			t.Errorf("%q: expected status %d, got %d (%s)", test.args, test.status, status, stderr.String())
+			continue
+		}
+		if status != 0 {
+			if stdout.Len() != 0 || stderr.Len() == 0 {
+				t.Errorf("%q: expected only an error, got %q, %q", test.args, stdout.String(), stderr.String())
+			}
+			continue
+		}
+		lines := bytes.Split(bytes.TrimSuffix(stdout.Bytes(), []byte("\n")), []byte("\n"))
+		if got := string(lines[len(lines)-1]); got != test.out {
+			t.Errorf("%q: expected %q, got %q", test.args, test.out, got)
+		}
+	}
+
+	// without -q the parsed components are printed first
+	var stdout, stderr bytes.Buffer
+	vercmp([]string{"foo-1.0rc2p1v2-gtk", "foo-1.0"}, &stdout, &stderr)
+	expected := "foo-1.0rc2p1v2-gtk: stem=foo version=1.0rc2p1v2 dewey=1.0 suffix=rc suffixvalue=2 p=1 v=2 flavor=gtk\n" +
+		"foo-1.0: stem=foo version=1.0 dewey=1.0 suffix= suffixvalue= p=-1 v=-1 flavor=\n" +
+		"foo-1.0rc2p1v2-gtk > foo-1.0\n"
+	if stdout.String() != expected {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,167 @@
+package gzip
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// maxNameLen and maxCommentLen are the longest name and comment accepted in
+// a header, NUL included
+const (
+	maxNameLen    = 512
+	maxCommentLen = 4194304
+)
+
+// headerReader reads a header byte by byte, so nothing past the header is
+// consumed, keeping the header digest and the number of bytes read.
+type headerReader struct {
+	r      io.ByteReader
+	digest uint32
+	n      int64
+}
+
+func (h *headerReader) readFull(p []byte) error {
+	for i := range p {
+		b, err := h.r.ReadByte()
+		if err != nil {
+			if i == 0 && err == io.EOF && h.n == 0 {
+				return io.EOF
+			}
+			return noEOF(err)
+		}
+		p[i] = b
+		h.n++
+	}
+	h.digest = crc32.Update(h.digest, crc32.IEEETable, p)
+	return nil
+}
+
+// readString reads a NUL-terminated ISO 8859-1 string and returns it as UTF-8
+func (h *headerReader) readString(max int) (string, error) {
+	var buf []byte
+	needConv := false
+	for {
+		if len(buf) >= max {
+			return "", ErrHeader
+		}
+		b, err := h.r.ReadByte()
+		if err != nil {
+			return "", noEOF(err)
+		}
+		h.n++
+		if b == 0 {
+			// digest covers the NUL terminator
+			h.digest = crc32.Update(h.digest, crc32.IEEETable, append(buf, 0))
+			break
+		}
+		if b > 0x7f {
+			needConv = true
+		}
+		buf = append(buf, b)
+	}
+
+	if needConv {
+		s := make([]rune, 0, len(buf))
+		for _, v := range buf {
+			s = append(s, rune(v))
+		}
+		return string(s), nil
+	}
+	return string(buf), nil
+}
+
+// readHeaderFrom reads a member header (RFC 1952, section 2.3.1) from r and
+// returns it with the number of bytes it took. io.EOF is only returned if r
+// is empty. Reader, ReadHeader, ParseHeader and MemberReader all use it.
+func readHeaderFrom(r io.ByteReader) (Header, int64, error) {
+	var hdr Header
+	var buf [10]byte
+	h := &headerReader{r: r}
+
+	if err := h.readFull(buf[:10]); err != nil {
+		return hdr, h.n, err
+	}
+	if buf[0] != gzipID1 || buf[1] != gzipID2 || buf[2] != gzipDeflate {
+		return hdr, h.n, ErrHeader
+	}
+	flg := buf[3]
+	if t := int64(le.Uint32(buf[4:8])); t > 0 {
+		hdr.ModTime = time.Unix(t, 0)
+	}
+	hdr.OS = buf[9]
+
+	var err error
+	if flg&flagExtra != 0 {
+		if err = h.readFull(buf[:2]); err != nil {
+			return hdr, h.n, noEOF(err)
+		}
+		hdr.Extra = make([]byte, le.Uint16(buf[:2]))
+		if err = h.readFull(hdr.Extra); err != nil {
+			return hdr, h.n, noEOF(err)
+		}
+	}
+
+	if flg&flagName != 0 {
+		if hdr.Name, err = h.readString(maxNameLen); err != nil {
+			return hdr, h.n, err
+		}
+	}
+
+	if flg&flagComment != 0 {
+		if hdr.Comment, err = h.readString(maxCommentLen); err != nil {
+			return hdr, h.n, err
+		}
+	}
+
+	if flg&flagHdrCrc != 0 {
+		digest := uint16(h.digest)
+		if err = h.readFull(buf[:2]); err != nil {
+			return hdr, h.n, noEOF(err)
+		}
+		if le.Uint16(buf[:2]) != digest {
+			return hdr, h.n, ErrHeader
+		}
+	}
+
+	return hdr, h.n, nil
+}
+
+// byteReader reads one byte at a time from a reader without io.ByteReader,
+// so nothing is read past the header
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(b.r, b.buf[:]); err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
+
+// ReadHeader reads a gzip header from r without setting up a decompressor
+// and returns it with the number of bytes it took. Nothing past the header is
+// read from r if r implements io.ByteReader; otherwise r is read one byte at a
+// time, so wrapping r in a bufio.Reader is worthwhile.
+func ReadHeader(r io.Reader) (Header, int64, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	return readHeaderFrom(br)
+}
+
+// ParseHeader parses the gzip header at the start of b and returns it with
+// its length, so the compressed data starts at b[n:]. If b ends before the
+// header does, it returns io.ErrUnexpectedEOF and the caller may retry with
+// a longer prefix.
+func ParseHeader(b []byte) (Header, int, error) {
+	hdr, n, err := readHeaderFrom(bytes.NewReader(b))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return hdr, int(n), err
+}
@@ -0,0 +1,67 @@
+package gzip
+
+import (
+	"bytes"
+	gzip2 "compress/gzip"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	// compress/gzip doesn't write FHCRC, so build the header by hand
+	var hdr bytes.Buffer
+	hdr.Write([]byte{gzipID1, gzipID2, gzipDeflate, flagExtra | flagName | flagComment | flagHdrCrc, 0x5a, 0x4b, 0x36, 0x65, 0, 3})
+	hdr.Write([]byte{3, 0, 'x', 'y', 'z'})
+	hdr.WriteString("quirks-7.14.tar\x00")
+	hdr.WriteString("untrusted comment: verify with openbsd-74-pkg.pub\ncaf\xe9\x00")
+	digest := crc32.ChecksumIEEE(hdr.Bytes())
+	hdr.Write([]byte{byte(digest), byte(digest >> 8)})
+	headerLen := hdr.Len()
+
+	var data bytes.Buffer
+	w := gzip2.NewWriter(&data)
+	w.Write([]byte("payload"))
+	w.Close()
+	stream := append(hdr.Bytes(), data.Bytes()[10:]...)
+
+	h, n, err := ParseHeader(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != headerLen {
+		t.Errorf("expected header length %d, got %d", headerLen, n)
+	}
+	if string(h.Extra) != "xyz" || h.Name != "quirks-7.14.tar" || h.OS != 3 || h.ModTime.Unix() != 0x65364b5a {
+		t.Errorf("unexpected header %+v", h)
+	}
+	if h.Comment != "untrusted comment: verify with openbsd-74-pkg.pub\ncafé" {
+		t.Errorf("unexpected comment %q", h.Comment)
+	}
+
+	// ReadHeader leaves the reader at the compressed data
+	r := bytes.NewReader(stream)
+	if _, n, err := ReadHeader(r); err != nil || n != int64(headerLen) || r.Len() != len(stream)-headerLen {
+		t.Errorf("ReadHeader returned %d, %v with %d bytes left", n, err, r.Len())
+	}
+
+	// which reads as the rest of the member
+	z, err := NewReader(io.MultiReader(bytes.NewReader(stream[:headerLen]), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := io.ReadAll(z); err != nil || string(payload) != "payload" {
+		t.Errorf("unexpected payload %q (%v)", payload, err)
+	}
+
+	for i := 0; i < headerLen; i++ {
+		if _, _, err := ParseHeader(stream[:i]); err != io.ErrUnexpectedEOF {
+			t.Errorf("prefix of %d bytes: expected io.ErrUnexpectedEOF, got %v", i, err)
+		}
+	}
+
+	stream[headerLen-1] ^= 0xff
+	if _, _, err := ParseHeader(stream); err != ErrHeader {
+		t.Errorf("expected ErrHeader for a bad header checksum, got %v", err)
+	}
+}
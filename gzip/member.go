@@ -0,0 +1,143 @@
+package gzip
+
+import (
+	"bufio"
+	"compress/flate"
+	"hash/crc32"
+	"io"
+)
+
+// Member describes one member of a (possibly multi-member) gzip stream. A
+// signed OpenBSD package starts with a member whose header comment holds the
+// signify block, followed by members holding chunks of the tar archive.
+type Member struct {
+	Header
+	Offset     int64  // offset of the member's header in the stream
+	DataOffset int64  // offset of the compressed data
+	DataLength int64  // length of the compressed data
+	Length     int64  // length of the whole member: header, data and trailer
+	CRC32      uint32 // checksum of the uncompressed data, from the trailer
+	Size       uint32 // uncompressed size modulo 2^32, from the trailer
+}
+
+// countingReader is a flate.Reader counting the bytes read from it
+type countingReader struct {
+	r flate.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// MemberReader iterates over the members of a gzip stream, reporting where
+// each one is without returning its data.
+//
+// Deflate data carries no length, so the end of a member can only be found by
+// running the decompressor over it: listing the members costs a full
+// decompression pass over the stream, as much CPU as reading it with Reader.
+// The output is discarded but checked against the member's trailer.
+type MemberReader struct {
+	r            *countingReader
+	decompressor io.ReadCloser
+	err          error
+}
+
+func NewMemberReader(r io.Reader) *MemberReader {
+	fr, ok := r.(flate.Reader)
+	if !ok {
+		fr = bufio.NewReader(r)
+	}
+	return &MemberReader{r: &countingReader{r: fr}}
+}
+
+// Next skips over the next member and returns its description. It returns
+// io.EOF when there are no more members.
+func (m *MemberReader) Next() (Member, error) {
+	if m.err != nil {
+		return Member{}, m.err
+	}
+
+	member, err := m.next()
+	if err != nil {
+		m.err = err
+		return Member{}, err
+	}
+	return member, nil
+}
+
+func (m *MemberReader) next() (Member, error) {
+	member := Member{Offset: m.r.n}
+
+	var err error
+	member.Header, _, err = readHeaderFrom(m.r)
+	if err != nil {
+		return Member{}, err
+	}
+	member.DataOffset = m.r.n
+
+	if m.decompressor == nil {
+		m.decompressor = flate.NewReader(m.r)
+	} else {
+		m.decompressor.(flate.Resetter).Reset(m.r, nil)
+	}
+	digest := crc32.NewIEEE()
+	size, err := io.Copy(digest, m.decompressor)
+	if err != nil {
+		return Member{}, noEOF(err)
+	}
+	member.DataLength = m.r.n - member.DataOffset
+
+	var trailer [8]byte
+	if _, err := io.ReadFull(m.r, trailer[:]); err != nil {
+		return Member{}, noEOF(err)
+	}
+	member.CRC32 = le.Uint32(trailer[:4])
+	member.Size = le.Uint32(trailer[4:8])
+	if member.CRC32 != digest.Sum32() || member.Size != uint32(size) {
+		return Member{}, ErrChecksum
+	}
+	member.Length = m.r.n - member.Offset
+
+	return member, nil
+}
+
+// Members returns all members of the gzip stream read from r. Like
+// MemberReader, it decompresses the whole stream to find them.
+func Members(r io.Reader) ([]Member, error) {
+	var members []Member
+
+	mr := NewMemberReader(r)
+	for {
+		member, err := mr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+}
+
+// OpenMember returns a Reader for the uncompressed data of the member, given
+// a reader positioned at the member's offset (for example a section of a
+// file or an HTTP range request). Only that member is read.
+func OpenMember(r io.Reader) (*Reader, error) {
+	z, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	z.Multistream(false)
+	return z, nil
+}
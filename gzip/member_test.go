@@ -0,0 +1,80 @@
+package gzip
+
+import (
+	"bytes"
+	gzip2 "compress/gzip"
+	"io"
+	"testing"
+)
+
+func multiMember(t *testing.T, comment string, chunks ...string) []byte {
+	var buf bytes.Buffer
+	for i, chunk := range chunks {
+		w := gzip2.NewWriter(&buf)
+		if i == 0 {
+			w.Comment = comment
+		}
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestMembers(t *testing.T) {
+	chunks := []string{"", "first chunk", string(bytes.Repeat([]byte("second chunk "), 1000))}
+	stream := multiMember(t, "untrusted comment: signify block", chunks...)
+
+	members, err := Members(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != len(chunks) {
+		t.Fatalf("expected %d members, got %d", len(chunks), len(members))
+	}
+	if members[0].Comment != "untrusted comment: signify block" || members[1].Comment != "" {
+		t.Errorf("unexpected comments %q, %q", members[0].Comment, members[1].Comment)
+	}
+
+	var offset int64
+	for i, m := range members {
+		if m.Offset != offset {
+			t.Errorf("member %d: expected offset %d, got %d", i, offset, m.Offset)
+		}
+		if m.DataOffset+m.DataLength+8 != m.Offset+m.Length {
+			t.Errorf("member %d: inconsistent lengths %+v", i, m)
+		}
+		if int(m.Size) != len(chunks[i]) {
+			t.Errorf("member %d: expected size %d, got %d", i, len(chunks[i]), m.Size)
+		}
+		offset += m.Length
+
+		z, err := OpenMember(io.NewSectionReader(bytes.NewReader(stream), m.Offset, m.Length))
+		if err != nil {
+			t.Fatalf("member %d: %s", i, err)
+		}
+		data, err := io.ReadAll(z)
+		if err != nil || string(data) != chunks[i] {
+			t.Errorf("member %d: read %d bytes (%v)", i, len(data), err)
+		}
+	}
+	if offset != int64(len(stream)) {
+		t.Errorf("members cover %d bytes of %d", offset, len(stream))
+	}
+
+	// a damaged trailer is reported
+	stream[members[1].Offset+members[1].Length-5] ^= 0xff
+	if _, err := Members(bytes.NewReader(stream)); err != ErrChecksum {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+
+	stream[members[1].Offset+members[1].Length-5] ^= 0xff
+
+	// as is a truncated stream
+	if _, err := Members(bytes.NewReader(stream[:len(stream)-3])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
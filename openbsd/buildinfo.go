@@ -0,0 +1,62 @@
+package openbsd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseBuildInfo returns the build date recorded in a BUILDINFO file:
+//
+//	Build date: 1697000000 - Wed Oct 11 04:53:20 UTC 2023
+func ParseBuildInfo(buildInfo string) (time.Time, error) {
+	for _, line := range strings.Split(buildInfo, "\n") {
+		if !strings.HasPrefix(line, "Build date: ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Build date: "))
+		if len(fields) == 0 {
+			break
+		}
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid build date in BUILDINFO: %q", line)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("no build date in BUILDINFO")
+}
+
+// GetBuildDate returns when the base system in a release or snapshot
+// directory, eg. https://cdn.openbsd.org/pub/OpenBSD/snapshots/amd64/, was
+// built: the date in its BUILDINFO or, if there's none, the modification
+// time of its SHA256.
+func GetBuildDate(mirror Mirror) (time.Time, error) {
+	body, err := mirror.OpenPackage("BUILDINFO")
+	if err == nil {
+		defer body.Close()
+		buildInfo, err := ioutil.ReadAll(body)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return ParseBuildInfo(string(buildInfo))
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, err
+	}
+
+	stat, err := mirror.StatPackage("SHA256")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if stat.ModTime.IsZero() {
+		return time.Time{}, fmt.Errorf("no BUILDINFO and no date for SHA256 on %s", mirror)
+	}
+
+	return stat.ModTime.UTC(), nil
+}
@@ -0,0 +1,27 @@
+package openbsd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetBuildDate(t *testing.T) {
+	buildInfo := "Build date: 1697000000 - Wed Oct 11 04:53:20 UTC 2023\n"
+	date, err := GetBuildDate(&MemMirror{Files: map[string][]byte{"BUILDINFO": []byte(buildInfo)}})
+	if err != nil || !date.Equal(time.Unix(1697000000, 0)) {
+		t.Errorf("unexpected build date %s (%v)", date, err)
+	}
+
+	// without BUILDINFO the date of SHA256 is used
+	modTime := time.Date(2023, 10, 12, 1, 2, 3, 0, time.UTC)
+	date, err = GetBuildDate(&MemMirror{Files: map[string][]byte{"SHA256": nil}, ModTime: modTime})
+	if err != nil || !date.Equal(modTime) {
+		t.Errorf("unexpected build date %s (%v)", date, err)
+	}
+
+	for _, bad := range []string{"", "Build date: soon\n"} {
+		if _, err := ParseBuildInfo(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package openbsd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Checksum is a line of a SHA256 or SHA256.sig file, as written by
+// "sha256 -b": SHA256 (filename) = base64 hash
+type Checksum struct {
+	Algorithm string
+	Filename  string
+	Hash      string
+}
+
+var checksumRe = regexp.MustCompile(`^(\S+) \((.+)\) = (\S+)$`)
+
+// ParseChecksums parses a checksum listing. The signify header of a
+// SHA256.sig (untrusted comment and signature lines) is skipped, not verified.
+func ParseChecksums(listing string) ([]Checksum, error) {
+	var checksums []Checksum
+
+	lines := strings.Split(listing, "\n")
+	if strings.HasPrefix(lines[0], "untrusted comment: ") {
+		if len(lines) < 2 {
+			return nil, fmt.Errorf("truncated checksum listing")
+		}
+		lines = lines[2:]
+	}
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		m := checksumRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("invalid checksum line: %q", line)
+		}
+		checksums = append(checksums, Checksum{Algorithm: m[1], Filename: m[2], Hash: m[3]})
+	}
+
+	return checksums, nil
+}
@@ -0,0 +1,157 @@
+package openbsd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FetchPackage downloads a package from m into dir, unless it's already
+// there. A partial download left in dir by an earlier attempt (name.part) is
+// resumed if the mirror supports ranges. If keyDir isn't empty, the package's
+// signature is checked before it's moved into place, and a package failing
+// the check is removed; a package that's already there is checked too, and
+// fetched again if it fails or differs from the mirror's in size or is older.
+func FetchPackage(m Mirror, name, dir, keyDir string) error {
+	dest := filepath.Join(dir, filepath.Base(name))
+	fi, statErr := os.Stat(dest)
+	if statErr == nil && keyDir == "" {
+		return nil
+	}
+	part := dest + ".part"
+
+	stat, err := m.StatPackage(name)
+	if err != nil {
+		return err
+	}
+
+	if statErr == nil {
+		if checkFetched(dest, fi, stat, keyDir) == nil {
+			return nil
+		}
+		// stale or tampered with, fetch it again
+		if err := os.Remove(dest); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	rm, ok := m.(RangeMirror)
+	if !ok || stat.Size < 0 || offset > stat.Size {
+		// start over
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if stat.Size < 0 || offset < stat.Size {
+		var body io.ReadCloser
+		if offset > 0 {
+			body, err = rm.OpenPackageRange(name, offset, stat.Size-offset)
+		} else {
+			body, err = m.OpenPackage(name)
+		}
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, body)
+		body.Close()
+		if err != nil {
+			// keep what we have for the next attempt
+			return fmt.Errorf("error downloading %s: %s", name, err)
+		}
+		offset += n
+	}
+	if stat.Size >= 0 && offset != stat.Size {
+		return fmt.Errorf("error downloading %s: got %d of %d bytes", name, offset, stat.Size)
+	}
+
+	if keyDir != "" {
+		if err := verifyPackage(f, keyDir); err != nil {
+			os.Remove(part)
+			return fmt.Errorf("refusing %s: %s", name, err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(part, dest)
+}
+
+// checkFetched returns an error if the package fetched into dest earlier
+// doesn't match the stat of the mirror's or fails the signature check. The
+// package keeps the date it was downloaded (setting the mirror's would need
+// pledge(2)'s fattr), so one the mirror has replaced since is newer there.
+func checkFetched(dest string, fi os.FileInfo, stat PackageStat, keyDir string) error {
+	if stat.Size >= 0 && fi.Size() != stat.Size {
+		return fmt.Errorf("%s: size differs from the mirror's", dest)
+	}
+	if !stat.ModTime.IsZero() && fi.ModTime().Before(stat.ModTime) {
+		return fmt.Errorf("%s: older than the mirror's", dest)
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return verifyPackage(f, keyDir)
+}
+
+// verifyPackage checks the signature of the package in f
+func verifyPackage(f *os.File, keyDir string) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, r, err := NewSignifyVerifier(f, keyDir)
+	if err == nil {
+		_, err = io.Copy(io.Discard, r)
+	}
+
+	return err
+}
+
+// FetchPackages downloads packages with FetchPackage, jobs at a time, and
+// returns their errors in the order of names
+func FetchPackages(m Mirror, names []string, dir, keyDir string, jobs int) []error {
+	errs := make([]error, len(names))
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = FetchPackage(m, names[i], dir, keyDir)
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,130 @@
+package openbsd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchPackages(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyNum := []byte("12345678")
+	keyDir := t.TempDir()
+	pubKey := "untrusted comment: test public key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyNum...), pub...)) + "\n"
+	if err := os.WriteFile(filepath.Join(keyDir, "test-pkg.pub"), []byte(pubKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := make([]byte, 3000)
+	rand.Read(payload)
+	signed := signGzip(t, priv, keyNum, payload, 256)
+	tampered := append([]byte(nil), signed...)
+	tampered[len(tampered)-20] ^= 0xff
+
+	m := &MemMirror{Files: map[string][]byte{
+		"foo-1.0.tgz": signed,
+		"bar-1.0.tgz": signed,
+		"bad-1.0.tgz": tampered,
+	}}
+
+	// an interrupted download of foo
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "foo-1.0.tgz.part"), signed[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"foo-1.0.tgz", "bar-1.0.tgz", "bad-1.0.tgz", "missing-1.0.tgz"}
+	errs := FetchPackages(m, names, dir, keyDir, 2)
+	for i, name := range names[:2] {
+		if errs[i] != nil {
+			t.Errorf("%s: %s", name, errs[i])
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || !bytes.Equal(data, signed) {
+			t.Errorf("%s wasn't fetched correctly (%v)", name, err)
+		}
+	}
+	if errs[2] == nil {
+		t.Errorf("expected an error for a tampered package")
+	}
+	for _, name := range []string{"bad-1.0.tgz", "bad-1.0.tgz.part", "foo-1.0.tgz.part"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s was left behind", name)
+		}
+	}
+	if errs[3] == nil {
+		t.Errorf("expected an error for a missing package")
+	}
+
+	// a part that's too long is started over; without keys nothing is checked
+	dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad-1.0.tgz.part"), append(tampered, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := FetchPackage(m, "bad-1.0.tgz", dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "bad-1.0.tgz")); !bytes.Equal(data, tampered) {
+		t.Errorf("unexpected contents after restarting a download")
+	}
+
+	// with keys, packages already there are checked against the mirror
+	rand.Read(payload)
+	rebuilt := signGzip(t, priv, keyNum, payload, 256)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	m = &MemMirror{Files: map[string][]byte{
+		"foo-1.0.tgz": signed,
+		"bar-1.0.tgz": signed,
+		"new-1.0.tgz": rebuilt,
+	}, ModTime: modTime}
+	dir = t.TempDir()
+	for name, data := range map[string][]byte{
+		"foo-1.0.tgz": signed,   // up to date
+		"bar-1.0.tgz": tampered, // same size, bad signature
+		"new-1.0.tgz": signed,   // replaced on the mirror since
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime.Add(-time.Hour), modTime.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(dir, "foo-1.0.tgz"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string][]byte{
+		"foo-1.0.tgz": signed,
+		"bar-1.0.tgz": signed,
+		"new-1.0.tgz": rebuilt,
+	} {
+		if err := FetchPackage(m, name, dir, keyDir); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		path := filepath.Join(dir, name)
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, expected) {
+			t.Errorf("%s wasn't checked against the mirror", name)
+		}
+		// the download date is kept, so the package isn't fetched again
+		if err := checkFetched(path, mustStat(t, path), PackageStat{Size: int64(len(expected)), ModTime: modTime}, keyDir); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fi
+}
@@ -0,0 +1,51 @@
+package openbsd
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+// DefaultFirmwareURL is where fw_update(8) fetches firmware from; %c is
+// replaced by the release or "snapshots"
+const DefaultFirmwareURL = "http://firmware.openbsd.org/firmware/%c/"
+
+// GetFirmwarePackages lists the firmware packages in a firmware directory
+// from its SHA256.sig, the same listing fw_update(8) uses
+func GetFirmwarePackages(mirror Mirror) (version.Packages, error) {
+	body, err := mirror.OpenPackage("SHA256.sig")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	listing, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := ParseChecksums(string(listing))
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs version.Packages
+	for _, checksum := range checksums {
+		if !strings.HasSuffix(checksum.Filename, ".tgz") {
+			continue
+		}
+		pkg, err := version.NewPackageFromString(strings.TrimSuffix(checksum.Filename, ".tgz"))
+		if err != nil {
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	return pkgs, nil
+}
+
+// FirmwareDriver returns the driver name fw_update(8) takes for a firmware
+// package stem, eg. "iwx" for "iwx-firmware"
+func FirmwareDriver(stem string) string {
+	return strings.TrimSuffix(stem, "-firmware")
+}
@@ -0,0 +1,25 @@
+package openbsd
+
+import (
+	"testing"
+)
+
+func TestGetFirmwarePackages(t *testing.T) {
+	listing := `untrusted comment: verify with openbsd-74-fw.pub
+RWRzSKR0s2b7ePh1nI6Tx1P0sZBEHAyRYR9YeOUcWVFCTyUPl0u2ZbxN7bWbxqVD1N2X0I1rL8OHGf4rJ3D2mQ3kM/sN3Jc2mAQ=
+SHA256 (index.txt) = Zm9vYmFy
+SHA256 (intel-firmware-20230808v0.tgz) = YmF6cXV4
+SHA256 (iwx-firmware-20230330.tgz) = cXV1eGZv
+`
+	pkgs, err := GetFirmwarePackages(&MemMirror{Files: map[string][]byte{"SHA256.sig": []byte(listing)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[0].Name.Stem != "intel-firmware" || pkgs[1].Name.Version.String() != "20230330" {
+		t.Errorf("unexpected firmware packages %v", pkgs)
+	}
+
+	if driver := FirmwareDriver("iwx-firmware"); driver != "iwx" {
+		t.Errorf("expected driver iwx, got %q", driver)
+	}
+}
@@ -3,30 +3,154 @@ package openbsd
 import (
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd/version"
 )
 
-func GetIndexTxt(mirror string) (string, error) {
-	indexUrl := fmt.Sprintf("%sindex.txt", mirror)
-	resp, err := http.Get(indexUrl)
+func GetIndexTxt(mirror Mirror) (string, error) {
+	body, err := mirror.OpenIndex()
+	if err != nil {
+		return "", fmt.Errorf("error downloading index from %s: %w\n", mirror, err)
+	}
+	defer body.Close()
+
+	indexBytes, err := ioutil.ReadAll(body)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	var indexBytes []byte
-	var indexString string
-	switch resp.StatusCode {
-	case 200:
-		indexBytes, err = ioutil.ReadAll(resp.Body)
+	return string(indexBytes), nil
+}
+
+// IndexEntry is a line of a mirror's index.txt. That file is ls(1) output,
+// usually "ls -lT", but mirrors produce a few variations (plain "ls -l", GNU
+// ls date styles, or bare file names), all of which are accepted.
+type IndexEntry struct {
+	Filename  string
+	Size      int64     // -1 if not listed
+	ModTime   time.Time // zero if not listed
+	IsPackage bool      // Filename is a .tgz with a valid package name
+	Name      version.PkgName
+}
+
+var isoDateRE = regexp.MustCompile(`^\d{4}-\d\d-\d\d$`)
+
+var months = map[string]bool{
+	"Jan": true, "Feb": true, "Mar": true, "Apr": true, "May": true, "Jun": true,
+	"Jul": true, "Aug": true, "Sep": true, "Oct": true, "Nov": true, "Dec": true,
+}
+
+var indexTimeLayouts = []string{
+	"Jan 2 15:04:05 2006",                 // ls -lT
+	"Jan 2 2006",                          // ls -l, older than six months
+	"Jan 2 15:04",                         // ls -l, recent: no year
+	"2006-01-02 15:04:05.999999999 -0700", // GNU ls --full-time
+	"2006-01-02 15:04:05 -0700",           // GNU ls --time-style=full-iso without fractions
+	"2006-01-02 15:04",                    // GNU ls --time-style=long-iso
+}
+
+// indexNow is used to guess the year of recent "ls -l" dates
+var indexNow = time.Now
+
+func parseIndexTime(s string) (time.Time, error) {
+	for _, layout := range indexTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		if layout == "Jan 2 15:04" {
+			// ls only omits the year for dates within the last six months
+			now := indexNow().UTC()
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.AddDate(0, 0, 1)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+func NewIndexEntryFromString(line string) (IndexEntry, error) {
+	entry := IndexEntry{Size: -1}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return IndexEntry{}, fmt.Errorf("empty index line")
+	}
+	// symlinks are listed as "name -> target"
+	for i, field := range fields {
+		if field == "->" && i > 0 {
+			fields = fields[:i]
+			break
+		}
+	}
+	entry.Filename = fields[len(fields)-1]
+
+	if len(fields) > 1 {
+		// the size is right before the date, which starts with either a
+		// month name or an ISO date
+		dateStart := -1
+		for i := 2; i < len(fields)-1; i++ {
+			if months[fields[i]] || isoDateRE.MatchString(fields[i]) {
+				dateStart = i
+				break
+			}
+		}
+		if dateStart == -1 {
+			return IndexEntry{}, fmt.Errorf("couldn't find date in index line: %q", line)
+		}
+
+		var err error
+		entry.Size, err = strconv.ParseInt(fields[dateStart-1], 10, 64)
+		if err != nil {
+			return IndexEntry{}, fmt.Errorf("invalid size in index line: %q", line)
+		}
+		entry.ModTime, err = parseIndexTime(strings.Join(fields[dateStart:len(fields)-1], " "))
+		if err != nil {
+			return IndexEntry{}, fmt.Errorf("%s in index line: %q", err, line)
+		}
+	}
+
+	if strings.HasSuffix(entry.Filename, ".tgz") {
+		name, err := version.NewPkgNameFromString(strings.TrimSuffix(entry.Filename, ".tgz"))
+		if err == nil {
+			entry.Name = name
+			entry.IsPackage = true
+		}
+	}
+
+	return entry, nil
+}
+
+// ParseIndexTxt parses the contents of an index.txt, skipping blank lines,
+// the "total" line ls prints first and lines it doesn't recognize. It only
+// fails if no line could be parsed.
+func ParseIndexTxt(index string) ([]IndexEntry, error) {
+	var entries []IndexEntry
+	var firstErr error
+
+	for i, line := range strings.Split(index, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "total ") {
+			continue
+		}
+		entry, err := NewIndexEntryFromString(line)
 		if err != nil {
-			return "", err
+			if firstErr == nil {
+				firstErr = fmt.Errorf("index.txt line %d: %s", i+1, err)
+			}
+			continue
 		}
-		indexString = string(indexBytes)
-		return indexString, nil
-	case 404:
-		return "", fmt.Errorf("404 encountered while downloading index: %s\n", indexUrl)
-	default:
-		return "", fmt.Errorf("unexpected HTTP response (%d) while downloading index: %s\n", resp.StatusCode, indexUrl)
+		entries = append(entries, entry)
 	}
+	if len(entries) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	return entries, nil
 }
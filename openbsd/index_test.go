@@ -0,0 +1,86 @@
+package openbsd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexEntryParsing(t *testing.T) {
+	indexNow = func() time.Time { return time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { indexNow = time.Now }()
+
+	tests := []struct {
+		line     string
+		filename string
+		size     int64
+		modTime  time.Time
+		stem     string
+	}{
+		// ls -lT, as produced by the OpenBSD mirrors
+		{"-rw-r--r--  1 1001  1001    69584 Oct 23 10:50:26 2023 quirks-6.159.tgz",
+			"quirks-6.159.tgz", 69584, time.Date(2023, 10, 23, 10, 50, 26, 0, time.UTC), "quirks"},
+		{"-rw-r--r--  1 1001  1001  5402624 Sep  1 08:03:12 2023 vim-9.0.1677-gtk3.tgz",
+			"vim-9.0.1677-gtk3.tgz", 5402624, time.Date(2023, 9, 1, 8, 3, 12, 0, time.UTC), "vim"},
+		// plain ls -l
+		{"-rw-r--r--  1 root  wheel  1024 Oct 23 10:50 p5-Net-SSLeay-1.92p0.tgz",
+			"p5-Net-SSLeay-1.92p0.tgz", 1024, time.Date(2023, 10, 23, 10, 50, 0, 0, time.UTC), "p5-Net-SSLeay"},
+		{"-rw-r--r--  1 root  wheel  1024 Dec 30 10:50 foo-1.0.tgz",
+			"foo-1.0.tgz", 1024, time.Date(2022, 12, 30, 10, 50, 0, 0, time.UTC), "foo"},
+		{"-rw-r--r--  1 root  wheel  2048 Mar  5  2021 bar-2.0.tgz",
+			"bar-2.0.tgz", 2048, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), "bar"},
+		// no group column
+		{"-rw-r--r--  1 root  2048 Mar  5  2021 bar-2.0.tgz",
+			"bar-2.0.tgz", 2048, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), "bar"},
+		// GNU ls
+		{"-rw-r--r-- 1 mirror mirror 4096 2023-10-23 10:50:26.000000000 +0000 baz-3.1.tgz",
+			"baz-3.1.tgz", 4096, time.Date(2023, 10, 23, 10, 50, 26, 0, time.UTC), "baz"},
+		{"-rw-r--r-- 1 mirror mirror 4096 2023-10-23 10:50 baz-3.1.tgz",
+			"baz-3.1.tgz", 4096, time.Date(2023, 10, 23, 10, 50, 0, 0, time.UTC), "baz"},
+		// bare file name
+		{"qux-0.1.tgz", "qux-0.1.tgz", -1, time.Time{}, "qux"},
+		// not a package
+		{"-rw-r--r--  1 1001  1001  1234 Oct 23 10:50:26 2023 SHA256.sig", "SHA256.sig", 1234,
+			time.Date(2023, 10, 23, 10, 50, 26, 0, time.UTC), ""},
+	}
+
+	for _, test := range tests {
+		entry, err := NewIndexEntryFromString(test.line)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.line, err)
+			continue
+		}
+		if entry.Filename != test.filename || entry.Size != test.size || !entry.ModTime.Equal(test.modTime) ||
+			entry.IsPackage != (test.stem != "") || entry.Name.Stem != test.stem {
+			t.Errorf("%q: unexpected entry: %+v", test.line, entry)
+		}
+	}
+
+	for _, bad := range []string{
+		"-rw-r--r--  1 1001  1001  69584 foo-1.0.tgz",
+		"-rw-r--r--  1 1001  1001  big Oct 23 10:50:26 2023 foo-1.0.tgz",
+		"-rw-r--r--  1 1001  1001  1234 Oct 99 10:50:26 2023 foo-1.0.tgz",
+	} {
+		if _, err := NewIndexEntryFromString(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+
+	entries, err := ParseIndexTxt("total 1234\n-rw-r--r--  1 1001  1001  69584 Oct 23 10:50:26 2023 quirks-6.159.tgz\n\n")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("unexpected ParseIndexTxt result: %v, %v", entries, err)
+	}
+
+	// symlinks and lines that don't parse don't spoil the rest
+	entries, err = ParseIndexTxt(`total 1234
+-rw-r--r--  1 1001  1001  69584 Oct 23 10:50:26 2023 quirks-6.159.tgz
+lrwxr-xr-x  1 1001  1001  14 Oct 23 10:50:26 2023 curl.tgz -> curl-8.4.0.tgz
+-rw-r--r--  1 1001  1001  big Oct 23 10:50:26 2023 foo-1.0.tgz
+-rw-r--r--  1 1001  1001  1234 Oct 23 10:50:26 2023 bar-1.0.tgz
+`)
+	if err != nil || len(entries) != 3 || entries[1].Filename != "curl.tgz" || entries[1].Size != 14 || entries[2].Filename != "bar-1.0.tgz" {
+		t.Errorf("unexpected ParseIndexTxt result: %+v, %v", entries, err)
+	}
+	if _, err := ParseIndexTxt("-rw-r--r--  1 1001  1001  big Oct 23 10:50:26 2023 foo-1.0.tgz\n"); err == nil {
+		t.Errorf("expected an error when no line parses")
+	}
+}
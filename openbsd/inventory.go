@@ -0,0 +1,119 @@
+package openbsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
+
+// Inventory is the installed packages of a host along with what's needed to
+// find the package index it upgrades from:
+//
+//	{
+//	  "hostname": "x1",
+//	  "arch": "amd64",
+//	  "version": "7.4",
+//	  "snapshot": false,
+//	  "packages": [
+//	    {"name": "curl-8.4.0", "signature": "...", "pkgpath": "net/curl"}
+//	  ]
+//	}
+type Inventory struct {
+	Hostname string             `json:"hostname"`
+	Arch     string             `json:"arch"`
+	Version  string             `json:"version"`
+	Snapshot bool               `json:"snapshot"`
+	Packages []InventoryPackage `json:"packages"`
+}
+
+// InventoryPackage is an installed package, as found in /var/db/pkg
+type InventoryPackage struct {
+	Name      string `json:"name"` // full name, eg. "vim-9.0.2100-no_x11"
+	Signature string `json:"signature"`
+	Pkgpath   string `json:"pkgpath"`
+	Branch    bool   `json:"branch,omitempty"`
+	Firmware  bool   `json:"firmware,omitempty"`
+	Manual    bool   `json:"manual,omitempty"` // not installed as a dependency
+}
+
+// ReadInventory reads and checks a JSON inventory
+func ReadInventory(r io.Reader) (Inventory, error) {
+	var inventory Inventory
+
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&inventory); err != nil {
+		return Inventory{}, fmt.Errorf("invalid inventory: %s", err)
+	}
+	if inventory.Arch == "" || inventory.Version == "" {
+		return Inventory{}, fmt.Errorf("inventory of %q is missing the arch or version", inventory.Hostname)
+	}
+	for _, pkg := range inventory.Packages {
+		if _, err := version.NewPackageFromString(pkg.Name); err != nil {
+			return Inventory{}, fmt.Errorf("inventory of %q: %s", inventory.Hostname, err)
+		}
+	}
+
+	return inventory, nil
+}
+
+// Package returns the parsed package name, signature and pkgpath
+func (p InventoryPackage) Package() (version.Package, error) {
+	pkg, err := version.NewPackageFromString(p.Name)
+	if err != nil {
+		return version.Package{}, err
+	}
+	pkg.Signature = p.Signature
+	pkg.Pkgpath = p.Pkgpath
+
+	return pkg, nil
+}
+
+// InstallSpec returns the pkg_add(1) spec for the package without its
+// version, so the newest one is installed, eg. "vim--no_x11" or
+// "python--%3.11"
+func (p InventoryPackage) InstallSpec() (string, error) {
+	pkg, err := p.Package()
+	if err != nil {
+		return "", err
+	}
+
+	spec := fmt.Sprintf("%s--%s", pkg.Name.Stem, pkg.Name.Flavor())
+	if p.Branch {
+		if branch := version.BranchFromPkgpath(p.Pkgpath); branch != "" {
+			spec = fmt.Sprintf("%s%%%s", spec, branch)
+		}
+	}
+
+	return spec, nil
+}
+
+// InstallCommand returns the pkg_add(1) invocation installing the manually
+// installed packages of the inventory; dependencies are pulled in by those
+// and firmware by fw_update(8)
+func (i Inventory) InstallCommand() ([]string, error) {
+	var specs []string
+	for _, pkg := range i.Packages {
+		if !pkg.Manual || pkg.Firmware {
+			continue
+		}
+		spec, err := pkg.InstallSpec()
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	sort.Strings(specs)
+
+	command := []string{"pkg_add"}
+	if i.Snapshot {
+		command = append(command, "-Dsnap")
+	}
+
+	return append(command, specs...), nil
+}
@@ -0,0 +1,87 @@
+package openbsd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadInventory(t *testing.T) {
+	inventory, err := ReadInventory(strings.NewReader(`{
+  "hostname": "x1",
+  "arch": "amd64",
+  "version": "7.4",
+  "packages": [
+    {"name": "vim-9.0.2100-no_x11", "signature": "vim-9.0.2100-no_x11,1,libc.97.1", "pkgpath": "editors/vim,no_x11"},
+    {"name": "iwx-firmware-20230330", "signature": "iwx-firmware-20230330", "pkgpath": "sysutils/firmware/iwx", "firmware": true}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Hostname != "x1" || inventory.Snapshot || len(inventory.Packages) != 2 || !inventory.Packages[1].Firmware {
+		t.Errorf("unexpected inventory %+v", inventory)
+	}
+
+	pkg, err := inventory.Packages[0].Package()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Name.Stem != "vim" || pkg.Name.Flavor() != "no_x11" || pkg.Pkgpath != "editors/vim,no_x11" || pkg.Signature != "vim-9.0.2100-no_x11,1,libc.97.1" {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+
+	inventory.Packages = append(inventory.Packages,
+		InventoryPackage{Name: "python-3.11.6p0", Pkgpath: "lang/python/3.11", Branch: true, Manual: true},
+		InventoryPackage{Name: "curl-8.4.0", Pkgpath: "net/curl", Manual: true},
+		InventoryPackage{Name: "nghttp2-1.57.0", Pkgpath: "www/nghttp2"},
+	)
+	inventory.Packages[0].Manual = true
+	inventory.Packages[1].Manual = true
+	inventory.Snapshot = true
+	command, err := inventory.InstallCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(command, " ") != "pkg_add -Dsnap curl-- python--%3.11 vim--no_x11" {
+		t.Errorf("unexpected install command %q", command)
+	}
+
+	for _, bad := range []string{
+		`{"hostname": "x1", "arch": "amd64", "packages": []}`,
+		`{"hostname": "x1", "arch": "amd64", "version": "7.4", "packages": [{"name": "novers"}]}`,
+		`not json`,
+	} {
+		if _, err := ReadInventory(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
+
+func TestInstallSpec(t *testing.T) {
+	tests := []struct {
+		pkg      InventoryPackage
+		expected string
+	}{
+		{InventoryPackage{Name: "curl-8.4.0", Pkgpath: "net/curl"}, "curl--"},
+		{InventoryPackage{Name: "vim-9.0.2100-no_x11", Pkgpath: "editors/vim,no_x11"}, "vim--no_x11"},
+		{InventoryPackage{Name: "python-3.11.6p0", Pkgpath: "lang/python/3.11", Branch: true}, "python--%3.11"},
+		{InventoryPackage{Name: "postgresql-client-15.5", Pkgpath: "databases/postgresql,-main", Branch: true}, "postgresql-client--"},
+		{InventoryPackage{Name: "php-gd-8.2.13-xpm", Pkgpath: "lang/php/8.2,-gd", Branch: true}, "php-gd--xpm%8.2"},
+		// the branch is only added for branch packages
+		{InventoryPackage{Name: "python-3.11.6p0", Pkgpath: "lang/python/3.11"}, "python--"},
+	}
+	for _, test := range tests {
+		spec, err := test.pkg.InstallSpec()
+		if err != nil {
+			t.Errorf("%s: %s", test.pkg.Name, err)
+			continue
+		}
+		if spec != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.pkg.Name, test.expected, spec)
+		}
+	}
+
+	if _, err := (InventoryPackage{Name: "novers"}).InstallSpec(); err == nil {
+		t.Errorf("expected an error for a name without a version")
+	}
+}
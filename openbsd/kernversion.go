@@ -0,0 +1,102 @@
+package openbsd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KernVersion is the parsed kern.version sysctl, eg:
+//
+//	OpenBSD 7.4 (GENERIC.MP) #1397: Tue Oct 10 09:02:37 MDT 2023
+//	    deraadt@amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP
+//
+// or "uname -a" output, which lacks the status and build date:
+//
+//	OpenBSD host.example.org 7.4 GENERIC.MP#1397 amd64
+type KernVersion struct {
+	OS        string    // "OpenBSD"
+	Release   string    // eg. "7.4"
+	Status    string    // "current", "beta", "stable" or "" for a release
+	Config    string    // kernel config name, eg. "GENERIC.MP"
+	Build     int       // build number
+	BuildDate time.Time // zero if unknown or unparseable; see zoneOffsets
+	BuildPath string    // user@host:/path/to/compile/dir, "" if unknown
+	Machine   string    // only set from uname output
+}
+
+var kernVersionRe = regexp.MustCompile(`^(\S+) (\d+\.\d+)(?:-(\w+))? \(([^)]+)\) #(\d+): (.*)$`)
+var unameRe = regexp.MustCompile(`^(\S+) \S+ (\d+\.\d+)(?:-(\w+))? ([^\s#]+)#(\d+) (\S+)$`)
+
+// kern.version dates are date(1) output; the time zone is an abbreviation
+// whose offset Go only knows if it's the local zone's
+const kernVersionTimeFormat = "Mon Jan 2 15:04:05 MST 2006"
+
+// zoneOffsets are the offsets (in hours) of the unambiguous zone
+// abbreviations kernels are likely to be built in; the official builds are
+// in MST/MDT. Dates in other zones are taken as UTC, so they may be off by
+// the zone's offset.
+var zoneOffsets = map[string]int{
+	"UTC": 0, "GMT": 0,
+	"MST": -7, "MDT": -6,
+	"PST": -8, "PDT": -7,
+	"EST": -5, "EDT": -4,
+	"CET": 1, "CEST": 2,
+	"EET": 2, "EEST": 3,
+	"JST":  9,
+	"AEST": 10, "AEDT": 11,
+}
+
+func parseKernVersionDate(s string) (time.Time, error) {
+	date, err := time.Parse(kernVersionTimeFormat, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	zone, _ := date.Zone()
+	if offset, ok := zoneOffsets[zone]; ok {
+		date = time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), 0, time.FixedZone(zone, offset*60*60))
+	}
+
+	return date, nil
+}
+
+func NewKernVersionFromString(s string) (KernVersion, error) {
+	var kv KernVersion
+
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	first := strings.Join(strings.Fields(lines[0]), " ")
+
+	if m := kernVersionRe.FindStringSubmatch(first); m != nil {
+		kv.OS, kv.Release, kv.Status, kv.Config = m[1], m[2], m[3], m[4]
+		kv.Build, _ = strconv.Atoi(m[5])
+		// an odd date only costs the build date
+		kv.BuildDate, _ = parseKernVersionDate(m[6])
+		if len(lines) > 1 {
+			kv.BuildPath = strings.TrimSpace(lines[1])
+		}
+	} else if m := unameRe.FindStringSubmatch(first); m != nil && len(lines) == 1 {
+		kv.OS, kv.Release, kv.Status, kv.Config = m[1], m[2], m[3], m[4]
+		kv.Build, _ = strconv.Atoi(m[5])
+		kv.Machine = m[6]
+	} else {
+		return KernVersion{}, fmt.Errorf("unrecognized kern.version: %q", lines[0])
+	}
+
+	return kv, nil
+}
+
+// IsSnapshot reports whether the kernel is a -current or -beta one, whose
+// packages are in the snapshots directory
+func (k KernVersion) IsSnapshot() bool {
+	return k.Status == "current" || k.Status == "beta"
+}
+
+func (k KernVersion) String() string {
+	release := k.Release
+	if k.Status != "" {
+		release = fmt.Sprintf("%s-%s", release, k.Status)
+	}
+	return fmt.Sprintf("%s %s (%s) #%d", k.OS, release, k.Config, k.Build)
+}
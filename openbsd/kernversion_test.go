@@ -0,0 +1,78 @@
+package openbsd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKernVersionParsing(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected KernVersion
+		date     string // build date in UTC
+		snapshot bool
+	}{
+		{"OpenBSD 7.4 (GENERIC.MP) #1397: Tue Oct 10 09:02:37 MDT 2023\n    deraadt@amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP\n",
+			KernVersion{OS: "OpenBSD", Release: "7.4", Config: "GENERIC.MP", Build: 1397, BuildPath: "deraadt@amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP"},
+			"2023-10-10 15:02:37", false},
+		// syspatch kernel, single digit day
+		{"OpenBSD 7.4 (GENERIC.MP) #2: Tue Dec  5 07:46:50 MST 2023\n    root@syspatch-74-amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP\n",
+			KernVersion{OS: "OpenBSD", Release: "7.4", Config: "GENERIC.MP", Build: 2, BuildPath: "root@syspatch-74-amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP"},
+			"2023-12-05 14:46:50", false},
+		{"OpenBSD 7.5-current (GENERIC.MP) #42: Mon Apr 15 10:12:47 MDT 2024\n    deraadt@amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP\n",
+			KernVersion{OS: "OpenBSD", Release: "7.5", Status: "current", Config: "GENERIC.MP", Build: 42, BuildPath: "deraadt@amd64.openbsd.org:/usr/src/sys/arch/amd64/compile/GENERIC.MP"},
+			"2024-04-15 16:12:47", true},
+		{"OpenBSD 7.6-beta (GENERIC) #261: Sun Sep 15 21:09:13 MDT 2024\n    deraadt@arm64.openbsd.org:/usr/src/sys/arch/arm64/compile/GENERIC\n",
+			KernVersion{OS: "OpenBSD", Release: "7.6", Status: "beta", Config: "GENERIC", Build: 261, BuildPath: "deraadt@arm64.openbsd.org:/usr/src/sys/arch/arm64/compile/GENERIC"},
+			"2024-09-16 03:09:13", true},
+		// locally built -stable kernel with a custom config
+		{"OpenBSD 7.3-stable (MYKERNEL) #0: Wed Nov  1 12:00:00 UTC 2023\n    root@build.example.org:/usr/src/sys/arch/amd64/compile/MYKERNEL\n",
+			KernVersion{OS: "OpenBSD", Release: "7.3", Status: "stable", Config: "MYKERNEL", Build: 0, BuildPath: "root@build.example.org:/usr/src/sys/arch/amd64/compile/MYKERNEL"},
+			"2023-11-01 12:00:00", false},
+		// two-digit minor and major versions
+		{"OpenBSD 10.12 (GENERIC) #1: Mon Jan  1 00:00:00 UTC 2035\n",
+			KernVersion{OS: "OpenBSD", Release: "10.12", Config: "GENERIC", Build: 1},
+			"2035-01-01 00:00:00", false},
+		// unknown zones are taken as UTC
+		{"OpenBSD 7.4 (GENERIC) #3: Wed Nov  1 12:00:00 XYZT 2023\n",
+			KernVersion{OS: "OpenBSD", Release: "7.4", Config: "GENERIC", Build: 3},
+			"2023-11-01 12:00:00", false},
+		// a date that doesn't parse leaves the build date unknown
+		{"OpenBSD 7.4 (GENERIC.MP) #1397: yesterday\n",
+			KernVersion{OS: "OpenBSD", Release: "7.4", Config: "GENERIC.MP", Build: 1397},
+			"", false},
+		{"OpenBSD host.example.org 7.4 GENERIC.MP#1397 amd64\n",
+			KernVersion{OS: "OpenBSD", Release: "7.4", Config: "GENERIC.MP", Build: 1397, Machine: "amd64"},
+			"", false},
+	}
+
+	for _, test := range tests {
+		kv, err := NewKernVersionFromString(test.in)
+		if err != nil {
+			t.Errorf("%q: %s", test.in, err)
+			continue
+		}
+		date := kv.BuildDate
+		kv.BuildDate = time.Time{}
+		if kv != test.expected {
+			t.Errorf("%q: expected %+v, got %+v", test.in, test.expected, kv)
+		}
+		if test.date == "" && !date.IsZero() || test.date != "" && date.UTC().Format("2006-01-02 15:04:05") != test.date {
+			t.Errorf("%q: expected build date %q, got %s", test.in, test.date, date)
+		}
+		if kv.IsSnapshot() != test.snapshot {
+			t.Errorf("%q: expected IsSnapshot() %v", test.in, test.snapshot)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"OpenBSD",
+		"OpenBSD 7.",
+		"Linux version 6.1.0 (gcc 12.2.0) #1 SMP\n",
+	} {
+		if _, err := NewKernVersionFromString(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
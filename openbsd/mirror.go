@@ -0,0 +1,395 @@
+package openbsd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neutralinsomniac/obsdpkgup/gzip"
+)
+
+// Mirror is a package directory, eg. https://cdn.openbsd.org/pub/OpenBSD/snapshots/packages/amd64/,
+// holding an index.txt and packages. Errors for missing files wrap
+// fs.ErrNotExist.
+type Mirror interface {
+	// OpenIndex opens the mirror's index.txt
+	OpenIndex() (io.ReadCloser, error)
+	// OpenPackage opens the named file in the mirror directory, usually a
+	// package such as "quirks-7.14.tgz"
+	OpenPackage(name string) (io.ReadCloser, error)
+	// StatPackage returns the size and modification time of the named file
+	StatPackage(name string) (PackageStat, error)
+	// String returns the mirror's location, for messages
+	String() string
+}
+
+// RangeMirror is a Mirror that can read part of a file, eg. with an HTTP
+// range request
+type RangeMirror interface {
+	Mirror
+	// OpenPackageRange opens length bytes of the named file starting at
+	// offset. Less is returned if the file ends first.
+	OpenPackageRange(name string, offset, length int64) (io.ReadCloser, error)
+}
+
+type PackageStat struct {
+	Size    int64 // -1 if unknown
+	ModTime time.Time
+}
+
+// NewMirror returns an HTTPMirror for http and https URLs and a DirMirror for
+// file URLs and local paths
+func NewMirror(location string) (Mirror, error) {
+	switch {
+	case strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://"):
+		return NewHTTPMirror(location), nil
+	case strings.HasPrefix(location, "file://"):
+		return &DirMirror{Dir: strings.TrimPrefix(location, "file://")}, nil
+	case strings.HasPrefix(location, "/"):
+		return &DirMirror{Dir: location}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mirror location: %q", location)
+	}
+}
+
+// HTTPMirror fetches files over http or https
+type HTTPMirror struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewHTTPMirror(baseUrl string) *HTTPMirror {
+	return &HTTPMirror{BaseURL: baseUrl, Client: http.DefaultClient}
+}
+
+func (m *HTTPMirror) url(name string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimRight(m.BaseURL, "/"), name)
+}
+
+func (m *HTTPMirror) do(method, name, byteRange string) (*http.Response, error) {
+	url := m.url(name)
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case 200, 206:
+		return resp, nil
+	case 404:
+		resp.Body.Close()
+		return nil, fmt.Errorf("404 while downloading %s: %w", url, fs.ErrNotExist)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP response (%d) while downloading %s", resp.StatusCode, url)
+	}
+}
+
+func (m *HTTPMirror) OpenIndex() (io.ReadCloser, error) {
+	return m.OpenPackage("index.txt")
+}
+
+func (m *HTTPMirror) OpenPackage(name string) (io.ReadCloser, error) {
+	resp, err := m.do("GET", name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (m *HTTPMirror) OpenPackageRange(name string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := m.do("GET", name, fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 200 {
+		// the server ignored the range
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	return readCloser{io.LimitReader(resp.Body, length), resp.Body}, nil
+}
+
+func (m *HTTPMirror) StatPackage(name string) (PackageStat, error) {
+	resp, err := m.do("HEAD", name, "")
+	if err != nil {
+		return PackageStat{}, err
+	}
+	resp.Body.Close()
+
+	stat := PackageStat{Size: resp.ContentLength}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		stat.ModTime, _ = http.ParseTime(lastModified)
+	}
+
+	return stat, nil
+}
+
+func (m *HTTPMirror) String() string {
+	return m.BaseURL
+}
+
+// DirMirror reads files from a local directory
+type DirMirror struct {
+	Dir string
+}
+
+func (m *DirMirror) path(name string) string {
+	// don't let names escape the mirror directory
+	return filepath.Join(m.Dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (m *DirMirror) OpenIndex() (io.ReadCloser, error) {
+	return m.OpenPackage("index.txt")
+}
+
+func (m *DirMirror) OpenPackage(name string) (io.ReadCloser, error) {
+	return os.Open(m.path(name))
+}
+
+func (m *DirMirror) OpenPackageRange(name string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(m.path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return readCloser{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+func (m *DirMirror) StatPackage(name string) (PackageStat, error) {
+	fi, err := os.Stat(m.path(name))
+	if err != nil {
+		return PackageStat{}, err
+	}
+
+	return PackageStat{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (m *DirMirror) String() string {
+	return m.Dir
+}
+
+// MemMirror serves files from memory, for tests and fixtures. If Files has no
+// "index.txt", OpenIndex generates one in "ls -lT" format.
+type MemMirror struct {
+	Files   map[string][]byte
+	ModTime time.Time
+}
+
+func (m *MemMirror) OpenIndex() (io.ReadCloser, error) {
+	if _, ok := m.Files["index.txt"]; ok {
+		return m.OpenPackage("index.txt")
+	}
+
+	names := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var index bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&index, "-rw-r--r--  1 0  0  %d %s %s\n", len(m.Files[name]), m.ModTime.UTC().Format("Jan _2 15:04:05 2006"), name)
+	}
+
+	return io.NopCloser(&index), nil
+}
+
+func (m *MemMirror) OpenPackage(name string) (io.ReadCloser, error) {
+	data, ok := m.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemMirror) OpenPackageRange(name string, offset, length int64) (io.ReadCloser, error) {
+	data, ok := m.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(data), offset, length)), nil
+}
+
+func (m *MemMirror) StatPackage(name string) (PackageStat, error) {
+	data, ok := m.Files[name]
+	if !ok {
+		return PackageStat{}, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+
+	return PackageStat{Size: int64(len(data)), ModTime: m.ModTime}, nil
+}
+
+func (m *MemMirror) String() string {
+	return "memory"
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// packageHeaderPrefix is how much of a package is fetched at first to read
+// its header; the signify block of a small package fits
+const packageHeaderPrefix = 8192
+
+// ReadPackageHeader returns the gzip header of the named package, whose
+// comment holds the signify block of signed packages, without downloading
+// the rest of the package. Mirrors supporting ranges are asked for a small
+// prefix, growing it if the header doesn't fit; others are read until the
+// end of the header and closed.
+func ReadPackageHeader(m Mirror, name string) (gzip.Header, error) {
+	if rm, ok := m.(RangeMirror); ok {
+		for size := int64(packageHeaderPrefix); ; size *= 4 {
+			body, err := rm.OpenPackageRange(name, 0, size)
+			if err != nil {
+				return gzip.Header{}, err
+			}
+			prefix, err := io.ReadAll(body)
+			body.Close()
+			if err != nil {
+				return gzip.Header{}, err
+			}
+
+			hdr, _, err := gzip.ParseHeader(prefix)
+			if err != io.ErrUnexpectedEOF || int64(len(prefix)) < size {
+				return hdr, err
+			}
+		}
+	}
+
+	body, err := m.OpenPackage(name)
+	if err != nil {
+		return gzip.Header{}, err
+	}
+	defer body.Close()
+
+	hdr, _, err := gzip.ReadHeader(bufio.NewReader(body))
+	return hdr, err
+}
+
+// MergedMirror is a view of several mirrors as one, eg. a release's
+// packages-stable and packages directories. Files are looked up in order, so
+// the first mirror takes precedence, and the index is the concatenation of
+// the mirrors' indexes. Mirrors missing a file or index are skipped.
+type MergedMirror struct {
+	Mirrors []Mirror
+}
+
+func NewMergedMirror(mirrors ...Mirror) *MergedMirror {
+	return &MergedMirror{Mirrors: mirrors}
+}
+
+func (m *MergedMirror) OpenIndex() (io.ReadCloser, error) {
+	var indexes []io.Reader
+	var closers []io.Closer
+	for _, mirror := range m.Mirrors {
+		index, err := mirror.OpenIndex()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		// index.txt ends with a newline, but don't count on it
+		indexes = append(indexes, index, strings.NewReader("\n"))
+		closers = append(closers, index)
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no index.txt in %s: %w", m, fs.ErrNotExist)
+	}
+
+	return readCloser{io.MultiReader(indexes...), multiCloser(closers)}, nil
+}
+
+func (m *MergedMirror) OpenPackage(name string) (io.ReadCloser, error) {
+	for _, mirror := range m.Mirrors {
+		body, err := mirror.OpenPackage(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return body, err
+		}
+	}
+
+	return nil, fmt.Errorf("%s not found in %s: %w", name, m, fs.ErrNotExist)
+}
+
+func (m *MergedMirror) OpenPackageRange(name string, offset, length int64) (io.ReadCloser, error) {
+	for _, mirror := range m.Mirrors {
+		var body io.ReadCloser
+		var err error
+		if rm, ok := mirror.(RangeMirror); ok {
+			body, err = rm.OpenPackageRange(name, offset, length)
+		} else if body, err = mirror.OpenPackage(name); err == nil {
+			if _, err := io.CopyN(io.Discard, body, offset); err != nil && err != io.EOF {
+				body.Close()
+				return nil, err
+			}
+			body = readCloser{io.LimitReader(body, length), body}
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return body, err
+		}
+	}
+
+	return nil, fmt.Errorf("%s not found in %s: %w", name, m, fs.ErrNotExist)
+}
+
+func (m *MergedMirror) StatPackage(name string) (PackageStat, error) {
+	for _, mirror := range m.Mirrors {
+		stat, err := mirror.StatPackage(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return stat, err
+		}
+	}
+
+	return PackageStat{}, fmt.Errorf("%s not found in %s: %w", name, m, fs.ErrNotExist)
+}
+
+func (m *MergedMirror) String() string {
+	var locations []string
+	for _, mirror := range m.Mirrors {
+		locations = append(locations, mirror.String())
+	}
+	return strings.Join(locations, " + ")
+}
+
+type multiCloser []io.Closer
+
+func (c multiCloser) Close() error {
+	return closeAll(c)
+}
+
+func closeAll(closers []io.Closer) error {
+	var firstErr error
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,172 @@
+package openbsd
+
+import (
+	"bytes"
+	gzip2 "compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrors(t *testing.T) {
+	files := map[string][]byte{
+		"foo-1.0.tgz": []byte("not really a package"),
+		"quirks-7.14.tgz": makePackage(t, "untrusted comment: verify with openbsd-74-pkg.pub",
+			"+CONTENTS", "@name quirks-7.14\n",
+			"libdata/perl5/site_perl/OpenBSD/Quirks.pm", testQuirksPm),
+	}
+
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generated, err := (&MemMirror{Files: files}).OpenIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := io.ReadAll(generated)
+	if err := os.WriteFile(filepath.Join(dir, "index.txt"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	dirMirror, err := NewMirror("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpMirror, err := NewMirror(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mirrors := []Mirror{
+		&MemMirror{Files: files, ModTime: time.Date(2023, 10, 23, 10, 50, 26, 0, time.UTC)},
+		dirMirror,
+		httpMirror,
+		// a release with no packages-stable yet
+		NewMergedMirror(&DirMirror{Dir: filepath.Join(dir, "stable")}, httpMirror),
+	}
+	for _, m := range mirrors {
+		indexString, err := GetIndexTxt(m)
+		if err != nil {
+			t.Errorf("%s: GetIndexTxt: %s", m, err)
+			continue
+		}
+		entries, err := ParseIndexTxt(indexString)
+		if err != nil || len(entries) != 2 || entries[0].Filename != "foo-1.0.tgz" || entries[0].Size != int64(len(files["foo-1.0.tgz"])) {
+			t.Errorf("%s: unexpected index %q (%v)", m, indexString, err)
+		}
+
+		body, err := m.OpenPackage("foo-1.0.tgz")
+		if err != nil {
+			t.Errorf("%s: OpenPackage: %s", m, err)
+			continue
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(data, files["foo-1.0.tgz"]) {
+			t.Errorf("%s: OpenPackage returned %q", m, data)
+		}
+
+		stat, err := m.StatPackage("foo-1.0.tgz")
+		if err != nil || stat.Size != int64(len(files["foo-1.0.tgz"])) {
+			t.Errorf("%s: StatPackage returned %+v, %v", m, stat, err)
+		}
+
+		if _, err := m.OpenPackage("bar-1.0.tgz"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected fs.ErrNotExist for a missing package, got %v", m, err)
+		}
+		if _, err := m.StatPackage("bar-1.0.tgz"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected fs.ErrNotExist when statting a missing package, got %v", m, err)
+		}
+
+		block, err := GetQuirksSignifyBlockFromIndex(m, indexString)
+		if err != nil || block != "untrusted comment: verify with openbsd-74-pkg.pub" {
+			t.Errorf("%s: GetQuirksSignifyBlockFromIndex returned %q, %v", m, block, err)
+		}
+
+		quirks, err := GetQuirksFromIndex(m, indexString)
+		if err != nil {
+			t.Errorf("%s: GetQuirksFromIndex: %s", m, err)
+		} else if renamed, _ := quirks.Renamed("gdm-fr"); renamed != "gdm" {
+			t.Errorf("%s: unexpected quirks %+v", m, quirks)
+		}
+	}
+
+	// headers larger than the first range request
+	var big bytes.Buffer
+	gz := gzip2.NewWriter(&big)
+	gz.Comment = strings.Repeat("x", 3*packageHeaderPrefix)
+	gz.Close()
+	hdr, err := ReadPackageHeader(&MemMirror{Files: map[string][]byte{"big-1.0.tgz": big.Bytes()}}, "big-1.0.tgz")
+	if err != nil || hdr.Comment != gz.Comment {
+		t.Errorf("ReadPackageHeader returned a %d byte comment, %v", len(hdr.Comment), err)
+	}
+
+	if _, err := NewMirror("ftp://example.org/pub/OpenBSD/"); err == nil {
+		t.Errorf("expected an error for an unsupported mirror")
+	}
+	if m := (&DirMirror{Dir: dir}); m.path("../../etc/passwd") != filepath.Join(dir, "etc/passwd") {
+		t.Errorf("DirMirror path escaped the mirror directory: %s", m.path("../../etc/passwd"))
+	}
+}
+
+func TestMergedMirror(t *testing.T) {
+	stable := &MemMirror{Files: map[string][]byte{
+		"foo-1.1.tgz": []byte("updated"),
+		"bar-1.0.tgz": []byte("stable bar"),
+	}}
+	release := &MemMirror{Files: map[string][]byte{
+		"foo-1.0.tgz": []byte("released"),
+		"bar-1.0.tgz": []byte("release bar"),
+		"baz-2.0.tgz": []byte("untouched"),
+	}}
+	m := NewMergedMirror(stable, release)
+
+	indexString, err := GetIndexTxt(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ParseIndexTxt(indexString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Filename)
+	}
+	if strings.Join(names, " ") != "bar-1.0.tgz foo-1.1.tgz bar-1.0.tgz baz-2.0.tgz foo-1.0.tgz" {
+		t.Errorf("unexpected merged index %v", names)
+	}
+
+	for name, want := range map[string]string{"bar-1.0.tgz": "stable bar", "baz-2.0.tgz": "untouched"} {
+		body, err := m.OpenPackageRange(name, 0, 64)
+		if err != nil {
+			t.Errorf("OpenPackageRange(%s): %s", name, err)
+			continue
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != want {
+			t.Errorf("OpenPackageRange(%s) returned %q, expected %q", name, data, want)
+		}
+	}
+
+	if _, err := m.StatPackage("qux-1.0.tgz"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for a package in neither tree, got %v", err)
+	}
+	if _, err := NewMergedMirror(&DirMirror{Dir: t.TempDir()}).OpenIndex(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist without any index, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package openbsd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Depend is an @depend annotation: pkgpath:pattern:default
+type Depend struct {
+	Pkgpath string
+	Pattern string // package spec the dependency must match
+	Default string // package name to install when nothing matches
+}
+
+// File is a packing list entry with contents: a plain line, one of the
+// file-like annotations (@file, @bin, @lib, @man, @shell, ...) or an info
+// file such as +DESC. The @sha, @size, @ts, @symlink and @link annotations
+// following it are recorded here.
+type File struct {
+	Type    string // annotation without the "@", "file" for plain lines
+	Name    string
+	Cwd     string // value of the last @cwd
+	SHA     string // base64-encoded SHA256
+	Size    int64  // -1 if unknown
+	Ts      int64  // -1 if unknown
+	Symlink string
+	Link    string
+}
+
+// Exec is an @exec/@unexec-style annotation
+type Exec struct {
+	Type    string // annotation without the "@", eg "exec" or "unexec-delete"
+	Command string
+}
+
+// DigitalSignature is an @digital-signature annotation, eg
+// "signify2:2023-10-18T17:26:40Z:external"
+type DigitalSignature struct {
+	Scheme string
+	Date   time.Time
+	Key    string
+}
+
+// Annotation is an annotation without a dedicated field in PackingList
+type Annotation struct {
+	Keyword string // without the "@"
+	Args    string
+}
+
+// PackingList is a parsed +CONTENTS file, see pkg_create(1)
+type PackingList struct {
+	Name             string
+	Version          int // 0 if there's no @version
+	Pkgpath          string
+	FTP              string // "yes" or "no", "" if not specified
+	CDROM            string
+	Comments         []string // @comment lines other than the pkgpath one
+	Arch             []string
+	Options          []string
+	Conflicts        []string
+	Depends          []Depend
+	Wantlibs         []string
+	Files            []File
+	Dirs             []string
+	Execs            []Exec
+	Samples          []string
+	Signer           string
+	DigitalSignature *DigitalSignature
+	Other            []Annotation
+}
+
+var fileTypes = map[string]bool{
+	"file":       true,
+	"bin":        true,
+	"lib":        true,
+	"man":        true,
+	"shell":      true,
+	"so":         true,
+	"static-lib": true,
+	"info":       true,
+	"rcscript":   true,
+	"font":       true,
+}
+
+var execTypes = map[string]bool{
+	"exec":          true,
+	"exec-add":      true,
+	"exec-always":   true,
+	"exec-update":   true,
+	"unexec":        true,
+	"unexec-always": true,
+	"unexec-delete": true,
+	"unexec-update": true,
+}
+
+func NewPackingListFromBytes(contents []byte) (PackingList, error) {
+	plist := PackingList{}
+	var cwd string
+	var lastFile *File
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "@") {
+			// plain file or info file (+DESC, +DISPLAY...)
+			plist.Files = append(plist.Files, File{Type: "file", Name: line, Cwd: cwd, Size: -1, Ts: -1})
+			lastFile = &plist.Files[len(plist.Files)-1]
+			continue
+		}
+
+		keyword, args, _ := strings.Cut(line[1:], " ")
+		if keyword == "" {
+			return PackingList{}, fmt.Errorf("line %d: empty annotation", lineNum)
+		}
+
+		var err error
+		switch {
+		case keyword == "name":
+			if plist.Name != "" {
+				return PackingList{}, fmt.Errorf("line %d: duplicate @name", lineNum)
+			}
+			plist.Name = args
+		case keyword == "version":
+			plist.Version, err = strconv.Atoi(args)
+		case keyword == "comment":
+			if strings.HasPrefix(args, "pkgpath=") {
+				for _, field := range strings.Fields(args) {
+					k, v, _ := strings.Cut(field, "=")
+					switch k {
+					case "pkgpath":
+						plist.Pkgpath = v
+					case "ftp":
+						plist.FTP = v
+					case "cdrom":
+						plist.CDROM = v
+					}
+				}
+				if plist.Pkgpath == "" {
+					err = fmt.Errorf("empty pkgpath")
+				}
+			} else {
+				plist.Comments = append(plist.Comments, args)
+			}
+		case keyword == "arch":
+			plist.Arch = strings.Split(args, ",")
+		case keyword == "option":
+			plist.Options = append(plist.Options, args)
+		case keyword == "conflict":
+			plist.Conflicts = append(plist.Conflicts, args)
+		case keyword == "depend":
+			parts := strings.Split(args, ":")
+			if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+				err = fmt.Errorf("expected pkgpath:pattern:default, got %q", args)
+				break
+			}
+			plist.Depends = append(plist.Depends, Depend{Pkgpath: parts[0], Pattern: parts[1], Default: parts[2]})
+		case keyword == "wantlib":
+			plist.Wantlibs = append(plist.Wantlibs, args)
+		case keyword == "cwd":
+			cwd = args
+		case fileTypes[keyword]:
+			plist.Files = append(plist.Files, File{Type: keyword, Name: args, Cwd: cwd, Size: -1, Ts: -1})
+			lastFile = &plist.Files[len(plist.Files)-1]
+		case keyword == "sha" || keyword == "size" || keyword == "ts" || keyword == "symlink" || keyword == "link":
+			if lastFile == nil {
+				err = fmt.Errorf("@%s without a preceding file", keyword)
+				break
+			}
+			switch keyword {
+			case "sha":
+				lastFile.SHA = args
+			case "size":
+				lastFile.Size, err = strconv.ParseInt(args, 10, 64)
+			case "ts":
+				lastFile.Ts, err = strconv.ParseInt(args, 10, 64)
+			case "symlink":
+				lastFile.Symlink = args
+			case "link":
+				lastFile.Link = args
+			}
+		case keyword == "dir" || keyword == "fontdir" || keyword == "mandir":
+			plist.Dirs = append(plist.Dirs, args)
+		case execTypes[keyword]:
+			plist.Execs = append(plist.Execs, Exec{Type: keyword, Command: args})
+		case keyword == "sample":
+			plist.Samples = append(plist.Samples, args)
+		case keyword == "signer":
+			plist.Signer = args
+		case keyword == "digital-signature":
+			var sig DigitalSignature
+			sig, err = newDigitalSignatureFromString(args)
+			plist.DigitalSignature = &sig
+		default:
+			plist.Other = append(plist.Other, Annotation{Keyword: keyword, Args: args})
+		}
+		if err != nil {
+			return PackingList{}, fmt.Errorf("line %d: invalid @%s: %s", lineNum, keyword, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return PackingList{}, err
+	}
+
+	if plist.Name == "" {
+		return PackingList{}, fmt.Errorf("packing list has no @name")
+	}
+
+	return plist, nil
+}
+
+func newDigitalSignatureFromString(s string) (DigitalSignature, error) {
+	// the date itself contains colons
+	first := strings.Index(s, ":")
+	last := strings.LastIndex(s, ":")
+	if first == -1 || first == last {
+		return DigitalSignature{}, fmt.Errorf("expected scheme:date:key, got %q", s)
+	}
+
+	date, err := time.Parse(SignifyTimeFormat, s[first+1:last])
+	if err != nil {
+		return DigitalSignature{}, err
+	}
+
+	return DigitalSignature{Scheme: s[:first], Date: date, Key: s[last+1:]}, nil
+}
+
+func (p PackingList) HasOption(option string) bool {
+	for _, o := range p.Options {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsBranch reports whether the package is one of several branches of a port
+// installable side by side (eg. python%3.11)
+func (p PackingList) IsBranch() bool {
+	return p.HasOption("is-branch")
+}
+
+// IsManual reports whether the package was installed explicitly rather than
+// as a dependency
+func (p PackingList) IsManual() bool {
+	return p.HasOption("manual-installation")
+}
+
+// IsFirmware reports whether the package is firmware installed by
+// fw_update(8)
+func (p PackingList) IsFirmware() bool {
+	return p.HasOption("firmware")
+}
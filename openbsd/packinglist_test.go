@@ -0,0 +1,122 @@
+package openbsd
+
+import (
+	"strings"
+	"testing"
+)
+
+const testContents = `@comment $OpenBSD: PLIST,v 1.10 2023/09/01 12:00:00 sthen Exp $
+@name gettext-runtime-0.22.5
+@version 3
+@comment pkgpath=devel/gettext,-runtime cdrom=yes ftp=yes
+@arch amd64
++DESC
+@sha HLGWFdmW9Nf3+mN2kk3Co3y/fGIj5TF4tj/fLbx2Q5M=
+@size 212
+@option manual-installation
+@conflict gettext-<0.10.40p0
+@depend converters/libiconv:libiconv-*:libiconv-1.17
+@wantlib c.97.1
+@wantlib iconv.7.1
+@cwd /usr/local
+@bin bin/envsubst
+@ts 1698001234
+@sha 4FJ0TrPGq6zG9nYBUb5hgmD6iJRwvBTnCr9pXWEfvpw=
+@size 34152
+@lib lib/libintl.so.8.0
+@ts 1698001234
+@sha wC2n7cFVfWVBoyOXjmZ4DDsIbE1XlEJcaQ4xcHkdvBY=
+@size 123456
+@dir share/gettext/
+share/gettext/ABOUT-NLS
+@ts 1698001234
+@sha xyz=
+@size 0
+share/locale/foo
+@symlink ../bar
+@sample ${SYSCONFDIR}/gettext.conf
+@exec %D/bin/envsubst --version
+@unexec-delete rm -f %D/share/gettext/cache
+@mode 0755
+@digital-signature signify2:2023-10-22T18:20:34Z:external
+`
+
+func TestPackingListParsing(t *testing.T) {
+	plist, err := NewPackingListFromBytes([]byte(testContents))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if plist.Name != "gettext-runtime-0.22.5" || plist.Version != 3 || plist.Pkgpath != "devel/gettext,-runtime" ||
+		plist.FTP != "yes" || plist.CDROM != "yes" {
+		t.Errorf("unexpected header fields: %q %d %q %q %q", plist.Name, plist.Version, plist.Pkgpath, plist.FTP, plist.CDROM)
+	}
+	if len(plist.Arch) != 1 || plist.Arch[0] != "amd64" {
+		t.Errorf("unexpected arch: %v", plist.Arch)
+	}
+	if !plist.IsManual() || plist.IsBranch() {
+		t.Errorf("unexpected options: %v", plist.Options)
+	}
+	if len(plist.Conflicts) != 1 || plist.Conflicts[0] != "gettext-<0.10.40p0" {
+		t.Errorf("unexpected conflicts: %v", plist.Conflicts)
+	}
+	if len(plist.Depends) != 1 || plist.Depends[0] != (Depend{"converters/libiconv", "libiconv-*", "libiconv-1.17"}) {
+		t.Errorf("unexpected depends: %v", plist.Depends)
+	}
+	if strings.Join(plist.Wantlibs, " ") != "c.97.1 iconv.7.1" {
+		t.Errorf("unexpected wantlibs: %v", plist.Wantlibs)
+	}
+	if len(plist.Comments) != 1 || !strings.HasPrefix(plist.Comments[0], "$OpenBSD") {
+		t.Errorf("unexpected comments: %v", plist.Comments)
+	}
+
+	if len(plist.Files) != 5 {
+		t.Fatalf("expected 5 files, got %d: %v", len(plist.Files), plist.Files)
+	}
+	desc := plist.Files[0]
+	if desc.Name != "+DESC" || desc.Size != 212 || desc.Ts != -1 || desc.Cwd != "" {
+		t.Errorf("unexpected +DESC entry: %+v", desc)
+	}
+	lib := plist.Files[2]
+	if lib.Type != "lib" || lib.Name != "lib/libintl.so.8.0" || lib.Cwd != "/usr/local" || lib.Size != 123456 ||
+		lib.Ts != 1698001234 || lib.SHA != "wC2n7cFVfWVBoyOXjmZ4DDsIbE1XlEJcaQ4xcHkdvBY=" {
+		t.Errorf("unexpected lib entry: %+v", lib)
+	}
+	if plist.Files[4].Symlink != "../bar" {
+		t.Errorf("unexpected symlink entry: %+v", plist.Files[4])
+	}
+
+	if len(plist.Dirs) != 1 || len(plist.Samples) != 1 || len(plist.Execs) != 2 || plist.Execs[1].Type != "unexec-delete" {
+		t.Errorf("unexpected dirs/samples/execs: %v %v %v", plist.Dirs, plist.Samples, plist.Execs)
+	}
+	if len(plist.Other) != 1 || plist.Other[0] != (Annotation{"mode", "0755"}) {
+		t.Errorf("unexpected other annotations: %v", plist.Other)
+	}
+	if plist.DigitalSignature == nil || plist.DigitalSignature.Scheme != "signify2" ||
+		plist.DigitalSignature.Key != "external" || plist.DigitalSignature.Date.Year() != 2023 {
+		t.Errorf("unexpected digital signature: %+v", plist.DigitalSignature)
+	}
+}
+
+func TestPackingListErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"@comment no name\n",
+		"@name foo-1.0\n@name bar-1.0\n",
+		"@name foo-1.0\n@version three\n",
+		"@name foo-1.0\n@sha abc=\n",
+		"@name foo-1.0\n@bin bin/foo\n@size big\n",
+		"@name foo-1.0\n@depend devel/bar:bar-*\n",
+		"@name foo-1.0\n@depend devel/bar::bar-1.0\n",
+		"@name foo-1.0\n@comment pkgpath= ftp=yes\n",
+		"@name foo-1.0\n@digital-signature signify2\n",
+		"@name foo-1.0\n@digital-signature signify2:yesterday:external\n",
+		"@name foo-1.0\n@\n",
+	}
+
+	for _, test := range tests {
+		if _, err := NewPackingListFromBytes([]byte(test)); err == nil {
+			t.Errorf("%q: expected error", test)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package openbsd
+
+import (
+	tar2 "archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/neutralinsomniac/obsdpkgup/gzip"
+)
+
+// maxMetadataFileSize bounds the size of a single metadata file
+const maxMetadataFileSize = 16 * 1024 * 1024
+
+// PackageMetadata holds the metadata files a package archive starts with:
+// +CONTENTS, +DESC and optionally +DISPLAY, +UNDISPLAY, +REQUIRE...
+type PackageMetadata struct {
+	Files map[string][]byte
+}
+
+// ReadPackageMetadata reads the metadata files from the start of a package
+// (a gzipped tar archive), stopping at the first file that isn't one. The
+// rest of r is left unread.
+func ReadPackageMetadata(r io.Reader) (PackageMetadata, error) {
+	metadata := PackageMetadata{Files: make(map[string][]byte)}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return PackageMetadata{}, err
+	}
+
+	tar := tar2.NewReader(gz)
+	for {
+		hdr, err := tar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return PackageMetadata{}, fmt.Errorf("error walking archive: %s", err)
+		}
+		if !strings.HasPrefix(hdr.Name, "+") {
+			break
+		}
+		if hdr.Size > maxMetadataFileSize {
+			return PackageMetadata{}, fmt.Errorf("%s is too large (%d bytes)", hdr.Name, hdr.Size)
+		}
+		data, err := ioutil.ReadAll(tar)
+		if err != nil {
+			return PackageMetadata{}, fmt.Errorf("error reading %s: %s", hdr.Name, err)
+		}
+		metadata.Files[hdr.Name] = data
+	}
+
+	if _, ok := metadata.Files["+CONTENTS"]; !ok {
+		return PackageMetadata{}, fmt.Errorf("package has no +CONTENTS")
+	}
+
+	return metadata, nil
+}
+
+// PackingList parses the package's +CONTENTS
+func (m PackageMetadata) PackingList() (PackingList, error) {
+	return NewPackingListFromBytes(m.Files["+CONTENTS"])
+}
+
+// Comment returns the one-line description of the package, the first line of
+// +DESC
+func (m PackageMetadata) Comment() string {
+	comment, _, _ := strings.Cut(string(m.Files["+DESC"]), "\n")
+	return strings.TrimSpace(comment)
+}
+
+// Description returns the long description of the package, the rest of +DESC
+func (m PackageMetadata) Description() string {
+	_, desc, _ := strings.Cut(string(m.Files["+DESC"]), "\n")
+	return strings.TrimSpace(desc)
+}
+
+// Display returns the message pkg_add(1) shows after installing the package
+func (m PackageMetadata) Display() string {
+	return string(m.Files["+DISPLAY"])
+}
+
+// Undisplay returns the message pkg_delete(1) shows after removing the package
+func (m PackageMetadata) Undisplay() string {
+	return string(m.Files["+UNDISPLAY"])
+}
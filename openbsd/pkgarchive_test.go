@@ -0,0 +1,60 @@
+package openbsd
+
+import (
+	tar2 "archive/tar"
+	"bytes"
+	gzip2 "compress/gzip"
+	"testing"
+)
+
+// makePackage builds a package archive from name, contents pairs
+func makePackage(t *testing.T, comment string, files ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip2.NewWriter(&buf)
+	gz.Comment = comment
+	tar := tar2.NewWriter(gz)
+	for i := 0; i+1 < len(files); i += 2 {
+		if err := tar.WriteHeader(&tar2.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1]))}); err != nil {
+			t.Fatal(err)
+		}
+		tar.Write([]byte(files[i+1]))
+	}
+	tar.Close()
+	gz.Close()
+
+	return buf.Bytes()
+}
+
+func TestReadPackageMetadata(t *testing.T) {
+	pkg := makePackage(t, "",
+		"+CONTENTS", "@name foo-1.0\n@comment pkgpath=misc/foo cdrom=yes ftp=yes\n",
+		"+DESC", "Foo frobnicator\nFoo frobnicates bars.\n\nMaintainer: Jane Doe <jane@example.org>\n",
+		"+DISPLAY", "Run foo-setup after installing.\n",
+		"bin/foo", "#!/bin/sh\n",
+		"+LATE", "not metadata",
+	)
+
+	metadata, err := ReadPackageMetadata(bytes.NewReader(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.Files) != 3 {
+		t.Errorf("expected 3 metadata files, got %d", len(metadata.Files))
+	}
+	if plist, err := metadata.PackingList(); err != nil || plist.Name != "foo-1.0" || plist.Pkgpath != "misc/foo" {
+		t.Errorf("unexpected packing list %+v (%v)", plist, err)
+	}
+	if metadata.Comment() != "Foo frobnicator" {
+		t.Errorf("unexpected comment %q", metadata.Comment())
+	}
+	if metadata.Description() != "Foo frobnicates bars.\n\nMaintainer: Jane Doe <jane@example.org>" {
+		t.Errorf("unexpected description %q", metadata.Description())
+	}
+	if metadata.Display() != "Run foo-setup after installing.\n" || metadata.Undisplay() != "" {
+		t.Errorf("unexpected messages %q, %q", metadata.Display(), metadata.Undisplay())
+	}
+
+	if _, err := ReadPackageMetadata(bytes.NewReader(makePackage(t, "", "bin/foo", ""))); err == nil {
+		t.Errorf("expected an error for a package without +CONTENTS")
+	}
+}
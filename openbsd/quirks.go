@@ -1,43 +1,402 @@
 package openbsd
 
 import (
+	tar2 "archive/tar"
 	"fmt"
 	"github.com/neutralinsomniac/obsdpkgup/gzip"
-	"net/http"
+	"io"
+	"io/ioutil"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
-func GetQuirksSignifyBlockFromIndex(baseUrl, index string) (string, error) {
-	lines := strings.Split(index, "\n")
-	for _, line := range lines {
-		if len(line) == 0 {
+func getQuirksPackageFromIndex(index string) (string, error) {
+	entries, err := ParseIndexTxt(index)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		if entry.IsPackage && entry.Name.Stem == "quirks" {
+			return entry.Filename, nil
+		}
+	}
+
+	return "", fmt.Errorf("couldn't find quirks package in index")
+}
+
+func GetQuirksSignifyBlockFromIndex(mirror Mirror, index string) (string, error) {
+	name, err := getQuirksPackageFromIndex(index)
+	if err != nil {
+		return "", err
+	}
+
+	hdr, err := ReadPackageHeader(mirror, name)
+	if err != nil {
+		return "", fmt.Errorf("error reading quirks header (%s): %s\n", name, err.Error())
+	}
+
+	return hdr.Comment, nil
+}
+
+// Quirks is the package data pkg_add(1) takes from the quirks package's
+// OpenBSD/Quirks.pm
+type Quirks struct {
+	Obsolete         map[string]int    // stem -> index into ObsoleteMessages
+	ObsoleteMessages []string          // why packages were removed
+	StemExtensions   map[string]string // old stem -> stem replacing it
+	DebugExceptions  map[string]bool   // stems that have no debug package
+}
+
+// perlToken is a string, number or bareword in a perl data structure, or
+// one of the punctuation characters we care about
+type perlToken struct {
+	value string
+	punct bool
+}
+
+// perlQuoteOps are the quote-like operators, with how many delimited parts
+// they take
+var perlQuoteOps = map[string]int{"q": 1, "qq": 1, "qw": 1, "m": 1, "qr": 1, "s": 2, "tr": 2, "y": 2}
+
+// perlClosing returns the delimiter closing open
+func perlClosing(open byte) byte {
+	switch open {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	case '{':
+		return '}'
+	case '<':
+		return '>'
+	}
+
+	return open
+}
+
+// readPerlDelimited reads the body of a quote-like construct whose opening
+// delimiter is at src[i], returning it and the index after the closing
+// delimiter
+func readPerlDelimited(src string, i int) (string, int) {
+	open, closing := src[i], perlClosing(src[i])
+	depth := 0
+	var sb strings.Builder
+	j := i + 1
+	for ; j < len(src); j++ {
+		c := src[j]
+		if c == '\\' && j+1 < len(src) {
+			j++
+			sb.WriteByte(src[j])
 			continue
 		}
-		s := strings.Fields(line)
-		pkgName := s[9]
-		if strings.HasPrefix(pkgName, "quirks-") {
-			url := fmt.Sprintf("%s%s", baseUrl, pkgName)
-			resp, err := http.Get(url)
-			if err != nil {
-				return "", fmt.Errorf("error fetching quirks (%s): %s", url, err.Error())
+		if c == closing && depth == 0 {
+			break
+		}
+		if open != closing {
+			if c == open {
+				depth++
+			} else if c == closing {
+				depth--
 			}
-			defer resp.Body.Close()
+		}
+		sb.WriteByte(c)
+	}
 
-			switch resp.StatusCode {
-			case 200:
-				gz, err := gzip.NewReader(resp.Body)
-				if err != nil {
-					return "", fmt.Errorf("error decompressing quirks %s: %s\n", url, err.Error())
-				}
+	return sb.String(), j + 1
+}
+
+// tokenizePerl splits perl source into the tokens needed to read simple
+// data structure literals. Comments and whitespace are dropped, "=>" is
+// returned as ",". Regexes and substitutions are skipped, q() and qq() are
+// returned as strings and qw() as comma-separated strings.
+func tokenizePerl(src string) []perlToken {
+	var tokens []perlToken
+
+	// a / starts a regex after these rather than dividing
+	regexFollows := func() bool {
+		if len(tokens) == 0 {
+			return true
+		}
+		switch last := tokens[len(tokens)-1]; last.value {
+		case "=~", "!~", "(", ",", "split", "grep", "if", "unless", "and", "or", "not", "return":
+			return true
+		}
+		return false
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '#' && (i == 0 || src[i-1] != '$'):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '\'' || c == '"':
+			value, next := readPerlDelimited(src, i)
+			tokens = append(tokens, perlToken{value: value})
+			i = next
+		case c == '/' && regexFollows():
+			_, i = readPerlDelimited(src, i)
+			for i < len(src) && unicode.IsLetter(rune(src[i])) {
+				i++
+			}
+		case c == '=' && i+1 < len(src) && src[i+1] == '>':
+			tokens = append(tokens, perlToken{value: ",", punct: true})
+			i += 2
+		case (c == '=' || c == '!') && i+1 < len(src) && src[i+1] == '~':
+			tokens = append(tokens, perlToken{value: src[i : i+2], punct: true})
+			i += 2
+		case strings.IndexByte("{}()[],;=$@%", c) != -1:
+			tokens = append(tokens, perlToken{value: string(c), punct: true})
+			i++
+		default:
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '-' || src[j] == '.' || src[j] == ':' ||
+				unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			if j == i {
+				// something we don't care about
+				j++
+			}
+			word := src[i:j]
+			variable := i > 0 && strings.IndexByte("$@%&>", src[i-1]) != -1 // $s, ->s
+			i = j
 
-				return gz.Comment, nil
-			case 404:
-				return "", fmt.Errorf("404 while downloading quirks: \"%s\"\n", url)
+			// quote-like operators, but not hash keys such as "s => 1"
+			k := j
+			for k < len(src) && (src[k] == ' ' || src[k] == '\t') {
+				k++
+			}
+			parts, ok := perlQuoteOps[word]
+			if !ok || variable || k >= len(src) || strings.IndexByte("=,;)}", src[k]) != -1 ||
+				(k > j && src[k] == '#') || unicode.IsLetter(rune(src[k])) || unicode.IsDigit(rune(src[k])) || unicode.IsSpace(rune(src[k])) {
+				tokens = append(tokens, perlToken{value: word})
+				continue
+			}
+			body, next := readPerlDelimited(src, k)
+			if parts == 2 {
+				if perlClosing(src[k]) != src[k] {
+					// s{...}{...}: the second part has its own delimiters
+					for next < len(src) && unicode.IsSpace(rune(src[next])) {
+						next++
+					}
+					if next < len(src) {
+						_, next = readPerlDelimited(src, next)
+					}
+				} else {
+					_, next = readPerlDelimited(src, next-1)
+				}
+			}
+			i = next
+			switch word {
+			case "q", "qq":
+				tokens = append(tokens, perlToken{value: body})
+			case "qw":
+				// lists flatten, so the words go straight into the
+				// surrounding one
+				for n, w := range strings.Fields(body) {
+					if n != 0 {
+						tokens = append(tokens, perlToken{value: ",", punct: true})
+					}
+					tokens = append(tokens, perlToken{value: w})
+				}
 			default:
-				return "", fmt.Errorf("unexpected HTTP response (%d) while downloading quirks: %s\n", resp.StatusCode, url)
+				// regexes and their modifiers
+				for i < len(src) && unicode.IsLetter(rune(src[i])) {
+					i++
+				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("couldn't find quirks package in index")
+	return tokens
+}
+
+// readPerlList reads the comma-separated scalars from tokens[start] (just
+// after the opening bracket) up to the matching close bracket. Nested
+// structures are returned as "". It returns the index after the closing
+// bracket.
+func readPerlList(tokens []perlToken, start int) ([]string, int) {
+	var values []string
+	depth := 0
+	expectValue := true
+
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.punct {
+			switch t.value {
+			case "{", "(", "[":
+				if depth == 0 {
+					values = append(values, "")
+					expectValue = false
+				}
+				depth++
+			case "}", ")", "]":
+				if depth == 0 {
+					return values, i + 1
+				}
+				depth--
+			case ",":
+				if depth == 0 {
+					expectValue = true
+				}
+			}
+			continue
+		}
+		if depth == 0 && expectValue {
+			values = append(values, t.value)
+			expectValue = false
+		}
+	}
+
+	return values, len(tokens)
+}
+
+func NewQuirksFromString(quirksPm string) (Quirks, error) {
+	quirks := Quirks{
+		Obsolete:        make(map[string]int),
+		StemExtensions:  make(map[string]string),
+		DebugExceptions: make(map[string]bool),
+	}
+
+	hashes := make(map[string]map[string]string)
+	tokens := tokenizePerl(quirksPm)
+	for i := 0; i+3 < len(tokens); i++ {
+		// my $name = { ... };  my @name = ( ... );
+		if tokens[i].value == "my" && (tokens[i+1].value == "$" || tokens[i+1].value == "@") && tokens[i+3].value == "=" &&
+			i+4 < len(tokens) && (tokens[i+4].value == "{" || tokens[i+4].value == "(") {
+			name := tokens[i+2].value
+			values, next := readPerlList(tokens, i+5)
+			if tokens[i+1].value == "@" {
+				// indexed as $msg[$reason] by filter_obsolete
+				if name == "msg" {
+					quirks.ObsoleteMessages = values
+				}
+			} else {
+				hash := make(map[string]string)
+				for j := 0; j+1 < len(values); j += 2 {
+					hash[values[j]] = values[j+1]
+				}
+				hashes[name] = hash
+			}
+			i = next - 1
+			continue
+		}
+
+		// setup_obsolete_reason(reason => stem, reason => qw(stem ...), ...)
+		if tokens[i].value == "setup_obsolete_reason" && tokens[i+1].value == "(" {
+			values, next := readPerlList(tokens, i+2)
+			reason := -1
+			for _, value := range values {
+				if n, err := strconv.Atoi(value); err == nil {
+					reason = n
+					continue
+				}
+				if reason == -1 {
+					return Quirks{}, fmt.Errorf("no obsolete reason for %q", value)
+				}
+				if value != "" {
+					quirks.Obsolete[value] = reason
+				}
+			}
+			i = next - 1
+		}
+	}
+
+	for stem, reason := range hashes["obsolete_reason"] {
+		n, err := strconv.Atoi(reason)
+		if err != nil {
+			return Quirks{}, fmt.Errorf("invalid obsolete reason %q for %q", reason, stem)
+		}
+		quirks.Obsolete[stem] = n
+	}
+	for from, to := range hashes["stem_extensions"] {
+		if to != "" {
+			quirks.StemExtensions[from] = to
+		}
+	}
+	for stem := range hashes["debug_exceptions"] {
+		quirks.DebugExceptions[stem] = true
+	}
+
+	if len(quirks.Obsolete) == 0 && len(quirks.StemExtensions) == 0 {
+		return Quirks{}, fmt.Errorf("no obsolete packages or stem extensions found in quirks")
+	}
+
+	return quirks, nil
+}
+
+// ObsoleteReason returns why stem was removed from the ports tree, if it was
+func (q Quirks) ObsoleteReason(stem string) (string, bool) {
+	reason, ok := q.Obsolete[stem]
+	if !ok {
+		return "", false
+	}
+	if reason < 0 || reason >= len(q.ObsoleteMessages) {
+		return "no reason given", true
+	}
+
+	return q.ObsoleteMessages[reason], true
+}
+
+// Renamed returns the stem that replaces stem, following chains of renames
+func (q Quirks) Renamed(stem string) (string, bool) {
+	renamed, ok := q.StemExtensions[stem]
+	if !ok {
+		return "", false
+	}
+
+	// guard against loops
+	for i := 0; i < len(q.StemExtensions); i++ {
+		next, ok := q.StemExtensions[renamed]
+		if !ok || next == stem {
+			break
+		}
+		renamed = next
+	}
+
+	return renamed, true
+}
+
+// GetQuirksFromIndex downloads the quirks package listed in index and parses
+// its OpenBSD/Quirks.pm
+func GetQuirksFromIndex(mirror Mirror, index string) (Quirks, error) {
+	name, err := getQuirksPackageFromIndex(index)
+	if err != nil {
+		return Quirks{}, err
+	}
+
+	body, err := mirror.OpenPackage(name)
+	if err != nil {
+		return Quirks{}, fmt.Errorf("error fetching quirks (%s): %s", name, err.Error())
+	}
+	defer body.Close()
+
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return Quirks{}, fmt.Errorf("error decompressing quirks %s: %s", name, err.Error())
+	}
+
+	tar := tar2.NewReader(gz)
+	for {
+		hdr, err := tar.Next()
+		if err == io.EOF {
+			return Quirks{}, fmt.Errorf("couldn't find OpenBSD/Quirks.pm in %s", name)
+		}
+		if err != nil {
+			return Quirks{}, fmt.Errorf("error walking archive %s: %s", name, err)
+		}
+		if strings.HasSuffix(hdr.Name, "OpenBSD/Quirks.pm") {
+			quirksPm, err := ioutil.ReadAll(tar)
+			if err != nil {
+				return Quirks{}, fmt.Errorf("error reading Quirks.pm from %s: %s", name, err)
+			}
+			return NewQuirksFromString(string(quirksPm))
+		}
+	}
 }
@@ -0,0 +1,211 @@
+package openbsd
+
+import (
+	"strings"
+	"testing"
+)
+
+// testQuirksPm follows the layout of ports/devel/quirks/files/Quirks.pm:
+// the reasons are in @msg, indexed by setup_obsolete_reason's numbers, among
+// subs full of regexes, qw() lists and comments
+const testQuirksPm = `#! /usr/bin/perl
+
+# ex:ts=8 sw=4:
+# $OpenBSD: Quirks.pm,v 1.1500 2023/10/23 10:50:26 sthen Exp $
+#
+# Copyright (c) 2009 Marc Espie <espie@openbsd.org>
+#
+# Permission to use, copy, modify, and distribute this software for any
+# purpose with or without fee is hereby granted, provided that the above
+# copyright notice and this permission notice appear in all copies.
+
+use strict;
+use warnings;
+
+package OpenBSD::Quirks;
+
+sub new
+{
+	my ($class, $version) = @_;
+	if ($version == 1) {
+		return OpenBSD::Quirks1->new;
+	} else {
+		return undef;
+	}
+}
+
+package OpenBSD::Quirks1;
+sub new
+{
+	my $class = shift;
+	bless {}, $class;
+}
+
+# ->tweak_list(\@l, $state):
+#	allows Quirks to remove some packages from the list before the 'real'
+#	updates happen
+sub tweak_list
+{
+}
+
+my $base_exceptions = {
+# 6.1
+	'/usr/local/bin/openssl' => ['openssl', 'libressl'],
+	'gdb' => 'gdb',
+};
+
+my $stem_extensions = {
+# 7.3
+	'gdm-fr' => 'gdm',
+	'py-foo' => 'py3-foo', # moved to python 3
+	"old-name" => "older-name",
+	'older-name' => 'new-name',
+	'loop-a' => 'loop-b',
+	'loop-b' => 'loop-a',
+};
+
+# ->is_base_system($handle, $state):
+#	checks whether an existing handle is now part of the base system
+#	and thus no longer needed.
+sub is_base_system
+{
+	my ($self, $handle, $state) = @_;
+
+	my $stem = OpenBSD::PackageName::splitstem($handle->pkgname);
+	my $test = $base_exceptions->{$stem};
+	return 0 unless defined $test;
+	if (ref $test) {
+		for my $t (@$test) {
+			return 1 if $t =~ m/^\/usr\/(?:local\/)?lib\/'?[^#]*$/;
+		}
+		return 0;
+	}
+	$test =~ s/#.*$//;
+	return $state->{installed}{$test} ? 1 : 0;
+}
+
+my $obsolete_reason = {};
+setup_obsolete_reason(
+# 7.3
+	0 => 'xv',
+	1 => 'foo-gtk',
+# 7.4
+	2 => qw(py-six py-mock),
+	0 => 'oldtool', 'oldtool-docs',
+);
+
+my @cve = qw(
+	www/chromium www/iridium
+);
+
+my $debug_exceptions = {
+	'firefox' => 1,
+};
+
+# reasons for obsolete packages
+my @msg = (
+	"is no longer maintained and has known security issues", # 0
+	"was removed upstream, use 'bar' instead",	# 1
+	"is no longer needed with python 3", # 2
+);
+
+sub setup_obsolete_reason
+{
+	my $reason = shift;
+	for my $p (@_) {
+		next if $p =~ /^#/;
+		$obsolete_reason->{$p} = $reason;
+	}
+	return $#_;
+}
+
+sub filter_obsolete
+{
+	my ($self, $list, $state) = @_;
+	for my $pkgname (@$list) {
+		my $stem = OpenBSD::PackageName::splitstem($pkgname);
+		my $reason = $obsolete_reason->{$stem};
+		if (defined $reason) {
+			$state->say("Obsolete package: #1 (#2)", $pkgname,
+			    $msg[$reason]);
+			$pkgname = undef;
+		}
+	}
+	return 0;
+}
+
+1;
+`
+
+func TestQuirksParsing(t *testing.T) {
+	quirks, err := NewQuirksFromString(testQuirksPm)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	reasons := map[string]string{
+		"xv":           "is no longer maintained and has known security issues",
+		"foo-gtk":      "was removed upstream, use 'bar' instead",
+		"py-six":       "is no longer needed with python 3",
+		"py-mock":      "is no longer needed with python 3",
+		"oldtool":      "is no longer maintained and has known security issues",
+		"oldtool-docs": "is no longer maintained and has known security issues",
+	}
+	for stem, expected := range reasons {
+		if reason, ok := quirks.ObsoleteReason(stem); !ok || reason != expected {
+			t.Errorf("unexpected reason for %s: %q, %t", stem, reason, ok)
+		}
+	}
+	if len(quirks.Obsolete) != len(reasons) || len(quirks.ObsoleteMessages) != 3 {
+		t.Errorf("unexpected obsolete packages %v, messages %q", quirks.Obsolete, quirks.ObsoleteMessages)
+	}
+	if _, ok := quirks.ObsoleteReason("vim"); ok {
+		t.Errorf("vim shouldn't be obsolete")
+	}
+
+	tests := map[string]string{
+		"gdm-fr":   "gdm",
+		"py-foo":   "py3-foo",
+		"old-name": "new-name",
+	}
+	for from, to := range tests {
+		if renamed, ok := quirks.Renamed(from); !ok || renamed != to {
+			t.Errorf("expected %s to be renamed to %s, got %q, %t", from, to, renamed, ok)
+		}
+	}
+	if _, ok := quirks.Renamed("loop-a"); !ok {
+		t.Errorf("expected loop-a to be renamed")
+	}
+	if _, ok := quirks.Renamed("/usr/local/bin/openssl"); ok {
+		t.Errorf("base exceptions aren't renames")
+	}
+
+	if !quirks.DebugExceptions["firefox"] || len(quirks.DebugExceptions) != 1 {
+		t.Errorf("unexpected debug exceptions: %v", quirks.DebugExceptions)
+	}
+
+	if _, err := NewQuirksFromString("package OpenBSD::Quirks;\n1;\n"); err == nil {
+		t.Errorf("expected error for empty quirks")
+	}
+	if _, err := NewQuirksFromString("setup_obsolete_reason('xv');\n"); err == nil {
+		t.Errorf("expected error for an obsolete package without a reason")
+	}
+}
+
+func TestTokenizePerl(t *testing.T) {
+	tests := map[string]string{
+		`my $h = { s => 'x', y => "z\"" };`:               `my $ h = { s , x , y , z" } ;`,
+		`$s =~ s{a#b}{c}g; $s->m(1); $x = $#a / 2;`:       `$ s =~ ; $ s- > m ( 1 ) ; $ x = $ # a / 2 ;`,
+		`@l = (q(a'b), qq{c}, qw(d e)); # comment 'x`:     `@ l = ( a'b , c , d , e ) ;`,
+		`return 1 if $t =~ m/^'[#]/ or split /,/, "f,g";`: `return 1 if $ t =~ or split , f,g ;`,
+	}
+	for src, expected := range tests {
+		var values []string
+		for _, token := range tokenizePerl(src) {
+			values = append(values, token.value)
+		}
+		if got := strings.Join(values, " "); got != expected {
+			t.Errorf("%s:\nexpected %s\ngot      %s", src, expected, got)
+		}
+	}
+}
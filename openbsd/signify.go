@@ -1,13 +1,30 @@
 package openbsd
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/neutralinsomniac/obsdpkgup/gzip"
 )
 
 var SignifyTimeFormat = time.RFC3339
 
+// SignifyKeyDir is where signify(1) public keys are installed
+const SignifyKeyDir = "/etc/signify"
+
 func GetSignifyTimestampFromSignifyBlock(signifyBlock string) (string, error) {
 	lines := strings.Split(signifyBlock, "\n")
 	for _, line := range lines {
@@ -18,3 +35,261 @@ func GetSignifyTimestampFromSignifyBlock(signifyBlock string) (string, error) {
 
 	return "", fmt.Errorf("could not find date in signify block")
 }
+
+var signifyHashes = map[string]func() hash.Hash{
+	"SHA256":     sha256.New,
+	"SHA512/256": sha512.New512_256,
+}
+
+// SignifyBlock is the signature block signify -zS stores in the comment of a
+// signed gzip file's header (this is how OpenBSD packages are signed):
+//
+//	untrusted comment: verify with openbsd-74-pkg.pub
+//	<base64 signature>
+//	date=2023-10-23T10:50:26Z
+//	key=/etc/signify/openbsd-74-pkg.pub
+//	algorithm=SHA512/256
+//	blocksize=65536
+//
+//	<hex digest of each block of the data following the header>
+//
+// The signature covers everything from "date=" on.
+type SignifyBlock struct {
+	UntrustedComment string
+	KeyNum           [8]byte
+	Signature        []byte
+	Message          []byte
+	Date             time.Time
+	Key              string // public key path, as recorded by the signer
+	Algorithm        string
+	BlockSize        int
+	Hashes           []string
+}
+
+func NewSignifyBlockFromString(block string) (SignifyBlock, error) {
+	var sb SignifyBlock
+
+	comment, rest, ok := strings.Cut(block, "\n")
+	if !ok || !strings.HasPrefix(comment, "untrusted comment: ") {
+		return SignifyBlock{}, fmt.Errorf("signify block doesn't start with an untrusted comment")
+	}
+	sb.UntrustedComment = strings.TrimPrefix(comment, "untrusted comment: ")
+
+	sigLine, message, ok := strings.Cut(rest, "\n")
+	if !ok {
+		return SignifyBlock{}, fmt.Errorf("truncated signify block")
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigLine)
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize || string(sig[:2]) != "Ed" {
+		return SignifyBlock{}, fmt.Errorf("invalid signature in signify block")
+	}
+	copy(sb.KeyNum[:], sig[2:10])
+	sb.Signature = sig[10:]
+	sb.Message = []byte(message)
+
+	header, hashes, ok := strings.Cut(message, "\n\n")
+	if !ok {
+		return SignifyBlock{}, fmt.Errorf("signify block has no hash list")
+	}
+	for _, line := range strings.Split(header, "\n") {
+		k, v, _ := strings.Cut(line, "=")
+		switch k {
+		case "date":
+			sb.Date, err = time.Parse(SignifyTimeFormat, v)
+		case "key":
+			sb.Key = v
+		case "algorithm":
+			sb.Algorithm = v
+			if _, ok := signifyHashes[v]; !ok {
+				err = fmt.Errorf("unsupported algorithm")
+			}
+		case "blocksize":
+			sb.BlockSize, err = strconv.Atoi(v)
+			if err == nil && sb.BlockSize <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		}
+		if err != nil {
+			return SignifyBlock{}, fmt.Errorf("invalid %q in signify block: %s", line, err)
+		}
+	}
+	if sb.Key == "" || sb.Algorithm == "" || sb.BlockSize == 0 {
+		return SignifyBlock{}, fmt.Errorf("signify block is missing key, algorithm or blocksize")
+	}
+
+	for _, h := range strings.Split(strings.TrimSuffix(hashes, "\n"), "\n") {
+		if h == "" {
+			continue
+		}
+		if _, err := hex.DecodeString(h); err != nil {
+			return SignifyBlock{}, fmt.Errorf("invalid hash %q in signify block", h)
+		}
+		sb.Hashes = append(sb.Hashes, h)
+	}
+
+	return sb, nil
+}
+
+// SignifyPublicKey is a signify(1) ed25519 public key
+type SignifyPublicKey struct {
+	UntrustedComment string
+	KeyNum           [8]byte
+	Key              ed25519.PublicKey
+}
+
+func NewSignifyPublicKeyFromBytes(b []byte) (SignifyPublicKey, error) {
+	var key SignifyPublicKey
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "untrusted comment: ") {
+		return SignifyPublicKey{}, fmt.Errorf("malformed signify public key")
+	}
+	key.UntrustedComment = strings.TrimPrefix(lines[0], "untrusted comment: ")
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return SignifyPublicKey{}, fmt.Errorf("malformed signify public key")
+	}
+	copy(key.KeyNum[:], raw[2:10])
+	key.Key = ed25519.PublicKey(raw[10:])
+
+	return key, nil
+}
+
+func ReadSignifyPublicKey(path string) (SignifyPublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return SignifyPublicKey{}, err
+	}
+
+	key, err := NewSignifyPublicKeyFromBytes(b)
+	if err != nil {
+		return SignifyPublicKey{}, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return key, nil
+}
+
+// Verify checks the block's signature with key. This proves the header fields
+// (including the date) and the hash list are genuine; use VerifyData or
+// NewSignifyVerifier to check the data itself.
+func (b SignifyBlock) Verify(key SignifyPublicKey) error {
+	if b.KeyNum != key.KeyNum {
+		return fmt.Errorf("signify block was signed with a different key")
+	}
+	if !ed25519.Verify(key.Key, b.Message, b.Signature) {
+		return fmt.Errorf("signify signature verification failed")
+	}
+
+	return nil
+}
+
+// VerifyWithKeyDir verifies the block with the key it names, looked up by
+// file name in keyDir (usually SignifyKeyDir). Like pkg_add(1), only package
+// keys (*-pkg.pub) are trusted, not the base, syspatch or firmware ones.
+func (b SignifyBlock) VerifyWithKeyDir(keyDir string) error {
+	name := filepath.Base(b.Key)
+	if !strings.HasSuffix(name, "-pkg.pub") {
+		return fmt.Errorf("refusing to verify with %s: not a package key", name)
+	}
+	key, err := ReadSignifyPublicKey(filepath.Join(keyDir, name))
+	if err != nil {
+		return err
+	}
+
+	return b.Verify(key)
+}
+
+// VerifyData checks that r (the data following the gzip header) matches the
+// block's hash list
+func (b SignifyBlock) VerifyData(r io.Reader) error {
+	_, err := io.Copy(io.Discard, newSignifyDataReader(r, b))
+	return err
+}
+
+type signifyDataReader struct {
+	r     io.Reader
+	block SignifyBlock
+	h     hash.Hash
+	n     int // bytes hashed in the current block
+	index int // current block
+}
+
+func newSignifyDataReader(r io.Reader, block SignifyBlock) *signifyDataReader {
+	return &signifyDataReader{r: r, block: block, h: signifyHashes[block.Algorithm]()}
+}
+
+func (s *signifyDataReader) checkBlock() error {
+	if s.index >= len(s.block.Hashes) {
+		return fmt.Errorf("signify: data is longer than signed")
+	}
+	if hex.EncodeToString(s.h.Sum(nil)) != s.block.Hashes[s.index] {
+		return fmt.Errorf("signify: hash mismatch in block %d", s.index)
+	}
+	s.h.Reset()
+	s.n = 0
+	s.index++
+
+	return nil
+}
+
+func (s *signifyDataReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for data := p[:n]; len(data) > 0; {
+		take := s.block.BlockSize - s.n
+		if take > len(data) {
+			take = len(data)
+		}
+		s.h.Write(data[:take])
+		s.n += take
+		data = data[take:]
+		if s.n == s.block.BlockSize {
+			if cerr := s.checkBlock(); cerr != nil {
+				return n, cerr
+			}
+		}
+	}
+
+	if err == io.EOF {
+		// the last block may be short (or empty)
+		if s.n > 0 || s.index == len(s.block.Hashes)-1 {
+			if cerr := s.checkBlock(); cerr != nil {
+				return n, cerr
+			}
+		}
+		if s.index != len(s.block.Hashes) {
+			return n, fmt.Errorf("signify: data is shorter than signed")
+		}
+	}
+
+	return n, err
+}
+
+// NewSignifyVerifier reads the header of a signify -zS signed gzip stream
+// from r, verifies the signature block in it with the matching key from
+// keyDir and returns a reader that yields the complete stream (header
+// included) while checking the data against the signed hashes.
+//
+// Data returned by the reader must be treated as unverified until it returns
+// io.EOF; a tampered or truncated stream results in an error instead.
+func NewSignifyVerifier(r io.Reader, keyDir string) (SignifyBlock, io.Reader, error) {
+	br := bufio.NewReader(r)
+	var header bytes.Buffer
+	hdr, _, err := gzip.ReadHeader(io.TeeReader(br, &header))
+	if err != nil {
+		return SignifyBlock{}, nil, err
+	}
+	if hdr.Comment == "" {
+		return SignifyBlock{}, nil, fmt.Errorf("not signed: no signify block in gzip header")
+	}
+
+	block, err := NewSignifyBlockFromString(hdr.Comment)
+	if err != nil {
+		return SignifyBlock{}, nil, err
+	}
+	if err := block.VerifyWithKeyDir(keyDir); err != nil {
+		return SignifyBlock{}, nil, err
+	}
+
+	return block, io.MultiReader(&header, newSignifyDataReader(br, block)), nil
+}
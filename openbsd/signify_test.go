@@ -0,0 +1,135 @@
+package openbsd
+
+import (
+	"bytes"
+	gzip2 "compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neutralinsomniac/obsdpkgup/gzip"
+)
+
+// signGzip mimics signify -zS: the data following a plain gzip header is
+// hashed in blocks and the signed hash list is stored in a new header comment
+func signGzip(t *testing.T, priv ed25519.PrivateKey, keyNum []byte, payload []byte, blockSize int) []byte {
+	var plain bytes.Buffer
+	w := gzip2.NewWriter(&plain)
+	w.Write(payload)
+	w.Close()
+	data := plain.Bytes()[10:] // no name/comment/extra: fixed size header
+
+	msg := fmt.Sprintf("date=2023-10-23T10:50:26Z\nkey=/etc/signify/test-pkg.pub\nalgorithm=SHA512/256\nblocksize=%d\n\n", blockSize)
+	for i := 0; i < len(data); i += blockSize {
+		end := i + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha512.Sum512_256(data[i:end])
+		msg += hex.EncodeToString(sum[:]) + "\n"
+	}
+
+	sig := append(append([]byte("Ed"), keyNum...), ed25519.Sign(priv, []byte(msg))...)
+	comment := "untrusted comment: verify with test-pkg.pub\n" + base64.StdEncoding.EncodeToString(sig) + "\n" + msg
+
+	var out bytes.Buffer
+	out.Write([]byte{0x1f, 0x8b, 8, 1 << 4, 0, 0, 0, 0, 0, 255})
+	out.WriteString(comment)
+	out.WriteByte(0)
+	out.Write(data)
+
+	return out.Bytes()
+}
+
+func TestSignifyVerifier(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyNum := []byte("12345678")
+
+	keyDir := t.TempDir()
+	pubKey := "untrusted comment: test public key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyNum...), pub...)) + "\n"
+	if err := os.WriteFile(filepath.Join(keyDir, "test-pkg.pub"), []byte(pubKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// incompressible, so the data spans several blocks
+	payload := make([]byte, 3000)
+	rand.Read(payload)
+	signed := signGzip(t, priv, keyNum, payload, 256)
+
+	block, r, err := NewSignifyVerifier(bytes.NewReader(signed), keyDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if block.Date.Year() != 2023 || block.BlockSize != 256 || len(block.Hashes) < 10 {
+		t.Errorf("unexpected signify block: %+v", block)
+	}
+	all, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error reading verified stream: %s", err)
+	}
+	if !bytes.Equal(all, signed) {
+		t.Errorf("verified stream differs from input")
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decompressed, _ := io.ReadAll(gz); !bytes.Equal(decompressed, payload) {
+		t.Errorf("payload mismatch")
+	}
+
+	// keys other than package keys aren't trusted
+	if err := os.WriteFile(filepath.Join(keyDir, "test-base.pub"), []byte(pubKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseBlock := block
+	baseBlock.Key = "/etc/signify/test-base.pub"
+	if err := baseBlock.VerifyWithKeyDir(keyDir); err == nil {
+		t.Errorf("expected an error for a block naming a base key")
+	}
+
+	// flip a byte in the data
+	tampered := append([]byte(nil), signed...)
+	tampered[len(tampered)-20] ^= 0xff
+	_, r, err = NewSignifyVerifier(bytes.NewReader(tampered), keyDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Errorf("expected hash mismatch for tampered data")
+	}
+
+	// truncated data
+	_, r, err = NewSignifyVerifier(bytes.NewReader(signed[:len(signed)-5]), keyDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Errorf("expected error for truncated data")
+	}
+
+	// signed with another key
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	if _, _, err := NewSignifyVerifier(bytes.NewReader(signGzip(t, otherPriv, keyNum, payload, 256)), keyDir); err == nil {
+		t.Errorf("expected signature verification failure")
+	}
+
+	// unsigned
+	var plain bytes.Buffer
+	w := gzip2.NewWriter(&plain)
+	w.Write(payload)
+	w.Close()
+	if _, _, err := NewSignifyVerifier(&plain, keyDir); err == nil {
+		t.Errorf("expected error for unsigned gzip")
+	}
+}
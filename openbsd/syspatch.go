@@ -0,0 +1,114 @@
+package openbsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// SyspatchDir is where syspatch(8) records installed patches
+const SyspatchDir = "/var/syspatch"
+
+// Syspatch is a binary patch: syspatch74-001_wifi.tgz on the mirror,
+// /var/syspatch/74-001_wifi once installed
+type Syspatch struct {
+	Release string // release without the dot, eg. "74"
+	Number  int
+	Name    string
+}
+
+var syspatchRe = regexp.MustCompile(`^(?:syspatch)?(\d+)-(\d+)_(.+?)(?:\.tgz)?$`)
+
+func NewSyspatchFromString(s string) (Syspatch, error) {
+	m := syspatchRe.FindStringSubmatch(s)
+	if m == nil {
+		return Syspatch{}, fmt.Errorf("invalid syspatch name: %q", s)
+	}
+	number, _ := strconv.Atoi(m[2])
+
+	return Syspatch{Release: m[1], Number: number, Name: m[3]}, nil
+}
+
+func (s Syspatch) String() string {
+	return fmt.Sprintf("%s-%03d_%s", s.Release, s.Number, s.Name)
+}
+
+func sortSyspatches(patches []Syspatch) {
+	sort.Slice(patches, func(i, j int) bool {
+		if patches[i].Release != patches[j].Release {
+			return patches[i].Release < patches[j].Release
+		}
+		return patches[i].Number < patches[j].Number
+	})
+}
+
+// GetSyspatches lists the patches in a syspatch mirror directory, eg.
+// https://cdn.openbsd.org/pub/OpenBSD/syspatch/7.4/amd64/, from its SHA256.sig
+func GetSyspatches(mirror Mirror) ([]Syspatch, error) {
+	body, err := mirror.OpenPackage("SHA256.sig")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	listing, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := ParseChecksums(string(listing))
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []Syspatch
+	for _, checksum := range checksums {
+		if patch, err := NewSyspatchFromString(checksum.Filename); err == nil {
+			patches = append(patches, patch)
+		}
+	}
+	sortSyspatches(patches)
+
+	return patches, nil
+}
+
+// InstalledSyspatches lists the patches installed according to dir, usually
+// SyspatchDir. A missing dir means none are.
+func InstalledSyspatches(dir string) ([]Syspatch, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []Syspatch
+	for _, entry := range entries {
+		if patch, err := NewSyspatchFromString(entry.Name()); err == nil && entry.IsDir() {
+			patches = append(patches, patch)
+		}
+	}
+	sortSyspatches(patches)
+
+	return patches, nil
+}
+
+// MissingSyspatches returns the available patches that aren't installed
+func MissingSyspatches(available, installed []Syspatch) []Syspatch {
+	have := make(map[string]bool)
+	for _, patch := range installed {
+		have[patch.String()] = true
+	}
+
+	var missing []Syspatch
+	for _, patch := range available {
+		if !have[patch.String()] {
+			missing = append(missing, patch)
+		}
+	}
+
+	return missing
+}
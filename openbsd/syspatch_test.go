@@ -0,0 +1,56 @@
+package openbsd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testSyspatchSHA256Sig = `untrusted comment: verify with openbsd-74-syspatch.pub
+RWRzSKR0s2b7ePh1nI6Tx1P0sZBEHAyRYR9YeOUcWVFCTyUPl0u2ZbxN7bWbxqVD1N2X0I1rL8OHGf4rJ3D2mQ3kM/sN3Jc2mAQ=
+SHA256 (syspatch74-002_xserver.tgz) = Zm9vYmFy
+SHA256 (syspatch74-001_wifi.tgz) = YmF6cXV4
+SHA256 (syspatch74-010_libssl.tgz) = cXV1eGZv
+`
+
+func TestSyspatches(t *testing.T) {
+	checksums, err := ParseChecksums(testSyspatchSHA256Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checksums) != 3 || checksums[0] != (Checksum{Algorithm: "SHA256", Filename: "syspatch74-002_xserver.tgz", Hash: "Zm9vYmFy"}) {
+		t.Errorf("unexpected checksums %+v", checksums)
+	}
+	if _, err := ParseChecksums("SHA256 syspatch74-001_wifi.tgz\n"); err == nil {
+		t.Errorf("expected an error for a malformed checksum line")
+	}
+
+	available, err := GetSyspatches(&MemMirror{Files: map[string][]byte{"SHA256.sig": []byte(testSyspatchSHA256Sig)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"74-001_wifi", "74-002_xserver"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	installed, err := InstalledSyspatches(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 2 || installed[0].String() != "74-001_wifi" {
+		t.Errorf("unexpected installed syspatches %v", installed)
+	}
+
+	missing := MissingSyspatches(available, installed)
+	if !reflect.DeepEqual(missing, []Syspatch{{Release: "74", Number: 10, Name: "libssl"}}) {
+		t.Errorf("unexpected missing syspatches %v", missing)
+	}
+
+	if installed, err := InstalledSyspatches(filepath.Join(dir, "nonexistent")); err != nil || len(installed) != 0 {
+		t.Errorf("expected no syspatches in a missing directory, got %v, %v", installed, err)
+	}
+}
@@ -2,67 +2,60 @@ package openbsd
 
 import (
 	"fmt"
-	"regexp"
 	"sort"
+	"strconv"
 	"strings"
-)
-
-var nameRe = regexp.MustCompilePOSIX(`^@name (.*)$`)
-var dependRe = regexp.MustCompilePOSIX(`^@depend (.*)$`)
-var versionRe = regexp.MustCompilePOSIX(`^@version (.*)$`)
-var wantLibRe = regexp.MustCompilePOSIX(`^@wantlib (.*)$`)
 
-var numRe = regexp.MustCompile(`^\d+.*$`)
+	"github.com/neutralinsomniac/obsdpkgup/openbsd/version"
+)
 
+// GenerateSignatureFromContents parses contents as a packing list and returns
+// its signature, or "" if it can't be parsed.
 func GenerateSignatureFromContents(contents []byte) string {
-	var signatureParts []string
-	// name
-	matches := nameRe.FindAllSubmatch(contents, -1)
-	for _, match := range matches {
-		signatureParts = append(signatureParts, string(match[1]))
+	plist, err := NewPackingListFromBytes(contents)
+	if err != nil {
+		return ""
 	}
 
-	// version
-	versionMatch := versionRe.FindSubmatch(contents)
-	if len(versionMatch) > 0 {
-		signatureParts = append(signatureParts, string(versionMatch[1]))
-	} else {
-		signatureParts = append(signatureParts, "0")
+	return plist.Signature()
+}
+
+// sortFlavors returns the package name with its flavors sorted, as they are
+// in the signature even if they aren't in +CONTENTS
+func sortFlavors(name string) string {
+	pkgName, err := version.NewPkgNameFromString(name)
+	if err != nil || len(pkgName.Flavors) < 2 {
+		return name
 	}
 
+	prefix := strings.TrimSuffix(name, fmt.Sprintf("-%s", pkgName.Flavor()))
+	flavors := append([]string(nil), pkgName.Flavors...)
+	sort.Strings(flavors)
+
+	return fmt.Sprintf("%s-%s", prefix, strings.Join(flavors, "-"))
+}
+
+// Signature returns the update signature pkg_add(1) uses to decide whether an
+// installed package needs to be replaced (see pkg_info -S): the package name,
+// the packing list version, the default package of every dependency and the
+// wantlibs.
+func (p PackingList) Signature() string {
+	signatureParts := []string{p.Name, strconv.Itoa(p.Version)}
+
 	// depends
-	var depends []string
-	matches = dependRe.FindAllSubmatch(contents, -1)
 	dependSet := make(map[string]bool)
-	for _, match := range matches {
-		dep := strings.Split(string(match[1]), ":")[2]
-		dep = fmt.Sprintf("@%s", dep)
-		dependSet[dep] = true
+	for _, depend := range p.Depends {
+		dependSet[fmt.Sprintf("@%s", sortFlavors(depend.Default))] = true
 	}
-	for dep, _ := range dependSet {
-		// get the flavor part
-		parts := strings.Split(dep, "-")
-		flavors := make([]string, 0, len(parts))
-		var i int
-		for i = len(parts) - 1; !numRe.MatchString(parts[i]); i-- {
-			flavors = append(flavors, parts[i])
-		}
-		// flavors are sorted in the signature even if they aren't in +CONTENTS
-		sort.Strings(flavors)
-		allParts := append(parts[:i+1], flavors...)
-		dep = strings.Join(allParts, "-")
+	depends := make([]string, 0, len(dependSet))
+	for dep := range dependSet {
 		depends = append(depends, dep)
 	}
 	sort.Strings(depends)
-
 	signatureParts = append(signatureParts, depends...)
 
 	// wantlib
-	var wantlibs []string
-	matches = wantLibRe.FindAllSubmatch(contents, -1)
-	for _, match := range matches {
-		wantlibs = append(wantlibs, string(match[1]))
-	}
+	wantlibs := append([]string(nil), p.Wantlibs...)
 	sort.Strings(wantlibs)
 	signatureParts = append(signatureParts, wantlibs...)
 
@@ -0,0 +1,71 @@
+package openbsd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/signatures holds +CONTENTS files from installed packages next to
+// the signature pkg_info -S printed for them, so the same-version rebuild
+// detection can't silently drift from pkg_add(1); see testdata/signatures/README.
+func TestSignatureGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/signatures/*.contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no +CONTENTS fixtures in testdata/signatures; capture them on OpenBSD as its README describes")
+	}
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plist, err := NewPackingListFromBytes(contents)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", file, err)
+			continue
+		}
+		signature := plist.Signature()
+
+		sigFile := strings.TrimSuffix(file, ".contents") + ".sig"
+		expected, err := os.ReadFile(sigFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature != strings.TrimSpace(string(expected)) {
+			t.Errorf("%s:\nexpected: %s\ngot:      %s", file, strings.TrimSpace(string(expected)), signature)
+		}
+
+		if GenerateSignatureFromContents(contents) != signature {
+			t.Errorf("%s: GenerateSignatureFromContents disagrees with PackingList.Signature", file)
+		}
+	}
+}
+
+// the rules Signature follows, independent of the fixtures above
+func TestPackingListSignature(t *testing.T) {
+	plist, err := NewPackingListFromBytes([]byte(`@name foo-1.0-b-a
+@version 2
+@comment pkgpath=misc/foo,a,b ftp=yes
+@depend devel/bar:bar-*:bar-2.1
+@depend devel/baz,x11,gtk:baz-*:baz-1.0-x11-gtk
+@depend devel/bar:bar->=2:bar-2.1
+@wantlib c.97.1
+@wantlib bar.3.0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flavors of depends sorted, duplicates dropped, depends then wantlibs
+	// each sorted
+	expected := "foo-1.0-b-a,2,@bar-2.1,@baz-1.0-gtk-x11,bar.3.0,c.97.1"
+	if signature := plist.Signature(); signature != expected {
+		t.Errorf("expected %s, got %s", expected, signature)
+	}
+}
@@ -0,0 +1,108 @@
+package version
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a list of version comparisons joined with "and" and "or",
+// eg ">=15 and <16" or "<8.3 or >=9.0". "and" binds tighter than "or", and
+// "," may be used in place of "and" as in package specs (">=15,<16").
+type Constraint struct {
+	alternatives [][]comparator
+}
+
+func NewConstraintFromString(s string) (Constraint, error) {
+	var constraint Constraint
+
+	tokens := strings.Fields(strings.ReplaceAll(s, ",", " and "))
+	if len(tokens) == 0 {
+		return Constraint{}, fmt.Errorf("empty version constraint")
+	}
+
+	var current []comparator
+	expectComparison := true
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if !expectComparison {
+			switch token {
+			case "or":
+				constraint.alternatives = append(constraint.alternatives, current)
+				current = nil
+			case "and":
+			default:
+				return Constraint{}, fmt.Errorf("expected \"and\" or \"or\" before %q in version constraint: %q", token, s)
+			}
+			expectComparison = true
+			continue
+		}
+
+		// allow whitespace between the operator and the version (">= 15")
+		if strings.Trim(token, "<>=") == "" && i+1 < len(tokens) {
+			i++
+			token += tokens[i]
+		}
+		cmp, err := newComparatorFromString(token)
+		if err != nil {
+			return Constraint{}, fmt.Errorf("%s in version constraint: %q", err, s)
+		}
+		current = append(current, cmp)
+		expectComparison = false
+	}
+
+	if expectComparison {
+		return Constraint{}, fmt.Errorf("version constraint ends with a conjunction: %q", s)
+	}
+	constraint.alternatives = append(constraint.alternatives, current)
+
+	return constraint, nil
+}
+
+// Check reports whether v satisfies the constraint. The zero Constraint is
+// satisfied by every version.
+func (c Constraint) Check(v Version) bool {
+	if len(c.alternatives) == 0 {
+		return true
+	}
+
+NEXTALTERNATIVE:
+	for _, comparators := range c.alternatives {
+		for _, cmp := range comparators {
+			if !cmp.check(v) {
+				continue NEXTALTERNATIVE
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func (c Constraint) String() string {
+	alternatives := make([]string, 0, len(c.alternatives))
+	for _, comparators := range c.alternatives {
+		parts := make([]string, 0, len(comparators))
+		for _, cmp := range comparators {
+			parts = append(parts, cmp.String())
+		}
+		alternatives = append(alternatives, strings.Join(parts, " and "))
+	}
+
+	return strings.Join(alternatives, " or ")
+}
+
+// PkgSpecVersion returns the constraint in the form used for the version part
+// of a package spec (">=15,<16"). Constraints containing "or" can't be
+// expressed that way, in which case ok is false.
+func (c Constraint) PkgSpecVersion() (spec string, ok bool) {
+	if len(c.alternatives) != 1 {
+		return "", false
+	}
+
+	parts := make([]string, 0, len(c.alternatives[0]))
+	for _, cmp := range c.alternatives[0] {
+		parts = append(parts, cmp.String())
+	}
+
+	return strings.Join(parts, ","), true
+}
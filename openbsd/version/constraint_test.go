@@ -0,0 +1,62 @@
+package version
+
+import (
+	"testing"
+)
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{">=15 and <16", "15.4", true},
+		{">=15 and <16", "15.4p1", true},
+		{">=15 and <16", "16.0", false},
+		{">=15 and <16", "14.9", false},
+		{">=15,<16", "15.0", true},
+		{">= 15, < 16", "16.1", false},
+		{"<8.3", "8.2.14", true},
+		{"<8.3", "8.3.0", false},
+		{"<8.3 or >=9.0", "9.0.1", true},
+		{"<8.3 or >=9.0", "8.3.2", false},
+		{">=1.0 and <2.0 or >=3.0 and <4.0", "3.5", true},
+		{">=1.0 and <2.0 or >=3.0 and <4.0", "2.5", false},
+		{"=1.01", "1.1", true},
+		{">1.0", "1.0p0", true},
+	}
+
+	for _, test := range tests {
+		c, err := NewConstraintFromString(test.constraint)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.constraint, err)
+			continue
+		}
+		if res := c.Check(NewVersionFromString(test.version)); res != test.expected {
+			t.Errorf("%s with %s: expected %t, got %t", test.constraint, test.version, test.expected, res)
+		}
+	}
+
+	for _, bad := range []string{"", "15", ">=15 <16", ">=15 and", "or <16", ">=15 and or <16", ">=", "~1.0"} {
+		if _, err := NewConstraintFromString(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+
+	c, _ := NewConstraintFromString(">= 15,<16 or =17")
+	if c.String() != ">=15 and <16 or =17" {
+		t.Errorf("unexpected String(): %q", c.String())
+	}
+}
+
+func TestConstraintPkgSpecVersion(t *testing.T) {
+	c, _ := NewConstraintFromString(">=15 and <16")
+	if spec, ok := c.PkgSpecVersion(); !ok || spec != ">=15,<16" {
+		t.Errorf("unexpected PkgSpecVersion(): %q, %t", spec, ok)
+	}
+
+	c, _ = NewConstraintFromString("<8.3 or >=9.0")
+	if _, ok := c.PkgSpecVersion(); ok {
+		t.Errorf("expected PkgSpecVersion() to fail for %q", c)
+	}
+}
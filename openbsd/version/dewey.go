@@ -32,6 +32,20 @@ func NewDeweyFromString(deweyStr string) Dewey {
 	return dewey
 }
 
+var deweyPartRE = regexp.MustCompile(`^\d[0-9A-Za-z]*$`)
+
+// ParseDewey is a strict version of NewDeweyFromString: it returns an error
+// if any dot-separated part is empty or doesn't start with a digit.
+func ParseDewey(deweyStr string) (Dewey, error) {
+	for _, part := range strings.Split(deweyStr, ".") {
+		if !deweyPartRE.MatchString(part) {
+			return Dewey{}, fmt.Errorf("invalid dewey number: %q", deweyStr)
+		}
+	}
+
+	return NewDeweyFromString(deweyStr), nil
+}
+
 func (d Dewey) String() string {
 	deweyStr := strings.Join(d.Deweys, ".")
 	if len(d.Suffix) != 0 {
@@ -41,6 +55,25 @@ func (d Dewey) String() string {
 	return deweyStr
 }
 
+func (d Dewey) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Dewey) UnmarshalText(text []byte) error {
+	dewey, err := ParseDewey(string(text))
+	if err != nil {
+		return err
+	}
+	*d = dewey
+
+	return nil
+}
+
+// Set implements flag.Value
+func (d *Dewey) Set(s string) error {
+	return d.UnmarshalText([]byte(s))
+}
+
 func (a Dewey) suffixCompare(b Dewey) int {
 	if a.Suffix == b.Suffix {
 		aNum, _ := strconv.Atoi(a.SuffixValue)
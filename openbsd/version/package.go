@@ -0,0 +1,76 @@
+package version
+
+import (
+	"strings"
+)
+
+// Package is an entry in a package index or in the local package database
+type Package struct {
+	FullName  string // name as found in the index, without .tgz
+	Name      PkgName
+	Signature string
+	Pkgpath   string
+}
+
+func NewPackageFromString(fullName string) (Package, error) {
+	name, err := NewPkgNameFromString(fullName)
+	if err != nil {
+		return Package{}, err
+	}
+
+	return Package{FullName: fullName, Name: name}, nil
+}
+
+func (p Package) String() string {
+	return p.FullName
+}
+
+// ComparePackages orders packages by stem, then version, then flavor and
+// pkgpath. It is suitable for use with sorting functions such as
+// slices.SortFunc.
+func ComparePackages(a, b Package) int {
+	if r := strings.Compare(a.Name.Stem, b.Name.Stem); r != 0 {
+		return r
+	}
+	if r := a.Name.Version.Compare(b.Name.Version); r != 0 {
+		return r
+	}
+	if r := strings.Compare(a.Name.Flavor(), b.Name.Flavor()); r != 0 {
+		return r
+	}
+
+	return strings.Compare(a.Pkgpath, b.Pkgpath)
+}
+
+// Packages implements sort.Interface using ComparePackages
+type Packages []Package
+
+func (p Packages) Len() int           { return len(p) }
+func (p Packages) Less(i, j int) bool { return ComparePackages(p[i], p[j]) < 0 }
+func (p Packages) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// NewestFunc returns the package with the highest version among those for
+// which match returns true. If several share that version the first one is
+// returned. ok is false if nothing matched.
+func (p Packages) NewestFunc(match func(Package) bool) (newest Package, ok bool) {
+	for _, pkg := range p {
+		if !match(pkg) {
+			continue
+		}
+		if !ok || newest.Name.Version.Compare(pkg.Name.Version) < 0 {
+			newest = pkg
+			ok = true
+		}
+	}
+
+	return newest, ok
+}
+
+// Newest returns the package with the highest version that has exactly the
+// given flavor and pkgpath, ie. a valid upgrade candidate for a package
+// installed with that flavor and pkgpath.
+func (p Packages) Newest(flavor, pkgpath string) (Package, bool) {
+	return p.NewestFunc(func(pkg Package) bool {
+		return pkg.Name.Flavor() == flavor && pkg.Pkgpath == pkgpath
+	})
+}
@@ -0,0 +1,88 @@
+package version
+
+import (
+	"sort"
+	"testing"
+)
+
+func newTestPackages(t *testing.T, entries ...[2]string) Packages {
+	var pkgs Packages
+	for _, e := range entries {
+		p, err := NewPackageFromString(e[0])
+		if err != nil {
+			t.Fatalf("%s: %s", e[0], err)
+		}
+		p.Pkgpath = e[1]
+		pkgs = append(pkgs, p)
+	}
+
+	return pkgs
+}
+
+func TestPackagesSort(t *testing.T) {
+	pkgs := newTestPackages(t,
+		[2]string{"vim-9.0.2092-no_x11", "editors/vim,no_x11"},
+		[2]string{"foo-1.10", "misc/foo"},
+		[2]string{"vim-9.0.2092-gtk3", "editors/vim,gtk3"},
+		[2]string{"foo-1.9p1", "misc/foo"},
+		[2]string{"foo-1.9", "misc/foo"},
+	)
+	sort.Sort(pkgs)
+
+	expected := []string{"foo-1.9", "foo-1.9p1", "foo-1.10", "vim-9.0.2092-gtk3", "vim-9.0.2092-no_x11"}
+	for i, p := range pkgs {
+		if p.FullName != expected[i] {
+			t.Errorf("position %d: expected %s, got %s", i, expected[i], p.FullName)
+		}
+	}
+
+	versions := Versions{NewVersionFromString("1.0p1"), NewVersionFromString("1.0v1"), NewVersionFromString("1.0")}
+	sort.Sort(versions)
+	if versions[0].String() != "1.0" || versions[2].String() != "1.0v1" {
+		t.Errorf("unexpected version order: %v", versions)
+	}
+}
+
+func TestPackagesNewest(t *testing.T) {
+	pkgs := newTestPackages(t,
+		[2]string{"python-3.10.13", "lang/python/3.10"},
+		[2]string{"python-3.11.7", "lang/python/3.11"},
+		[2]string{"python-3.11.6", "lang/python/3.11"},
+		[2]string{"vim-9.0.2092-gtk3", "editors/vim,gtk3"},
+		[2]string{"vim-9.1.0-no_x11", "editors/vim,no_x11"},
+		[2]string{"vim-9.0.1-no_x11", "editors/vim,no_x11"},
+	)
+
+	tests := []struct {
+		flavor   string
+		pkgpath  string
+		expected string
+	}{
+		{"", "lang/python/3.11", "python-3.11.7"},
+		{"", "lang/python/3.10", "python-3.10.13"},
+		{"gtk3", "editors/vim,gtk3", "vim-9.0.2092-gtk3"},
+		{"no_x11", "editors/vim,no_x11", "vim-9.1.0-no_x11"},
+		{"no_x11", "editors/vim,gtk3", ""},
+	}
+
+	for _, test := range tests {
+		p, ok := pkgs.Newest(test.flavor, test.pkgpath)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("(%s, %s): expected no match, got %s", test.flavor, test.pkgpath, p)
+			}
+			continue
+		}
+		if !ok || p.FullName != test.expected {
+			t.Errorf("(%s, %s): expected %s, got %s", test.flavor, test.pkgpath, test.expected, p)
+		}
+	}
+
+	constraint, _ := NewConstraintFromString("<3.11")
+	p, ok := pkgs.NewestFunc(func(p Package) bool {
+		return p.Name.Stem == "python" && constraint.Check(p.Name.Version)
+	})
+	if !ok || p.FullName != "python-3.10.13" {
+		t.Errorf("expected python-3.10.13, got %s", p)
+	}
+}
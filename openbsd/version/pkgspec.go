@@ -0,0 +1,315 @@
+package version
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// PkgName is a package name split into its stem, version and flavors, as
+// described in packages-specs(7): stem-version[-flavor1-flavor2...]
+type PkgName struct {
+	Stem    string
+	Version Version
+	Flavors []string
+}
+
+// the version starts at the first digit following a dash. bare versions
+// (no stem) are accepted so version strings can be handled the same way.
+var pkgNameRE = regexp.MustCompile(`^(?:(.*?)-)?(\d[^-]*)(.*)$`)
+
+func NewPkgNameFromString(name string) (PkgName, error) {
+	matches := pkgNameRE.FindStringSubmatch(name)
+	if matches == nil {
+		return PkgName{}, fmt.Errorf("couldn't find version in pkg: %q", name)
+	}
+
+	pkgName := PkgName{
+		Stem:    matches[1],
+		Version: NewVersionFromString(matches[2]),
+	}
+	for _, flavor := range strings.Split(matches[3], "-") {
+		if flavor != "" {
+			pkgName.Flavors = append(pkgName.Flavors, flavor)
+		}
+	}
+
+	return pkgName, nil
+}
+
+// Flavor returns the flavors joined in the order they appear in the name
+func (n PkgName) Flavor() string {
+	return strings.Join(n.Flavors, "-")
+}
+
+func (n PkgName) HasFlavor(flavor string) bool {
+	for _, f := range n.Flavors {
+		if f == flavor {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n PkgName) String() string {
+	name := n.Version.String()
+	if n.Stem != "" {
+		name = fmt.Sprintf("%s-%s", n.Stem, name)
+	}
+	if len(n.Flavors) != 0 {
+		name = fmt.Sprintf("%s-%s", name, n.Flavor())
+	}
+
+	return name
+}
+
+var branchRE = regexp.MustCompile(`^.*/.*/([^ ,]+).*$`)
+
+// BranchFromPkgpath returns the branch part of an is-branch package's
+// pkgpath (eg "3.11" for "lang/python/3.11,-main"), or "" if there is none.
+func BranchFromPkgpath(pkgpath string) string {
+	res := branchRE.FindStringSubmatch(pkgpath)
+	if len(res) != 2 {
+		return ""
+	}
+
+	return res[1]
+}
+
+// comparator is a single version constraint such as ">=1.2"
+type comparator struct {
+	op      string
+	version Version
+}
+
+var comparatorRE = regexp.MustCompile(`^(<=|>=|<|>|=)(\d.*)$`)
+
+func newComparatorFromString(s string) (comparator, error) {
+	matches := comparatorRE.FindStringSubmatch(s)
+	if matches == nil {
+		return comparator{}, fmt.Errorf("invalid version comparison: %q", s)
+	}
+
+	return comparator{op: matches[1], version: NewVersionFromString(matches[2])}, nil
+}
+
+func (c comparator) check(v Version) bool {
+	r := v.Compare(c.version)
+	switch c.op {
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	default:
+		return r == 0
+	}
+}
+
+func (c comparator) String() string {
+	return fmt.Sprintf("%s%s", c.op, c.version)
+}
+
+// PkgSpec is a package specification as accepted by pkg_add(1), eg "foo",
+// "foo-1.0-gtk", "foo->=1.2,<2.0", "foo-*-!gtk", "foo--" or "python%3.11".
+//
+// The stem may contain shell globs. The version may be empty or "*" (any
+// version), a shell glob ("1.*"), a comma-separated list of comparisons
+// (">=1.2,<2.0") or a plain version. The flavor part is a dash-separated list
+// of flavors; a flavor prefixed with "!" must not be present. An empty flavor
+// part ("foo--", "foo-*-") only matches packages without flavors.
+type PkgSpec struct {
+	Stem      string
+	Version   string
+	Flavor    string
+	HasFlavor bool // true when a flavor part, even an empty one, was given
+	Branch    string
+
+	comparators []comparator
+}
+
+var pkgSpecRE = regexp.MustCompile(`^(.*?)-((?:[<>=*]|\d)[^-]*|)(?:-(.*))?$`)
+
+func NewPkgSpecFromString(spec string) (PkgSpec, error) {
+	var pkgSpec PkgSpec
+
+	s := spec
+	if i := strings.LastIndex(s, "%"); i != -1 {
+		pkgSpec.Branch = s[i+1:]
+		s = s[:i]
+		if pkgSpec.Branch == "" {
+			return PkgSpec{}, fmt.Errorf("empty branch in package spec: %q", spec)
+		}
+	}
+
+	matches := pkgSpecRE.FindStringSubmatchIndex(s)
+	if matches == nil {
+		// stem only
+		pkgSpec.Stem = s
+	} else {
+		pkgSpec.Stem = s[matches[2]:matches[3]]
+		pkgSpec.Version = s[matches[4]:matches[5]]
+		if matches[6] != -1 {
+			pkgSpec.Flavor = s[matches[6]:matches[7]]
+			pkgSpec.HasFlavor = true
+		}
+	}
+
+	if pkgSpec.Stem == "" {
+		return PkgSpec{}, fmt.Errorf("empty stem in package spec: %q", spec)
+	}
+	if _, err := path.Match(pkgSpec.Stem, ""); err != nil {
+		return PkgSpec{}, fmt.Errorf("invalid stem in package spec %q: %s", spec, err)
+	}
+
+	switch {
+	case pkgSpec.Version == "" || pkgSpec.Version == "*":
+	case strings.ContainsAny(pkgSpec.Version[:1], "<>="):
+		for _, c := range strings.Split(pkgSpec.Version, ",") {
+			cmp, err := newComparatorFromString(c)
+			if err != nil {
+				return PkgSpec{}, fmt.Errorf("invalid version in package spec %q: %s", spec, err)
+			}
+			pkgSpec.comparators = append(pkgSpec.comparators, cmp)
+		}
+	case isGlob(pkgSpec.Version):
+		if _, err := path.Match(pkgSpec.Version, ""); err != nil {
+			return PkgSpec{}, fmt.Errorf("invalid version in package spec %q: %s", spec, err)
+		}
+	}
+
+	if pkgSpec.Flavor != "" {
+		for _, f := range strings.Split(pkgSpec.Flavor, "-") {
+			if f == "" || f == "!" {
+				return PkgSpec{}, fmt.Errorf("empty flavor in package spec: %q", spec)
+			}
+		}
+	}
+
+	return pkgSpec, nil
+}
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// isExact reports whether the spec names a single package (no wildcards or
+// comparisons in its version), in which case flavors must match exactly.
+func (s PkgSpec) isExact() bool {
+	return s.Version != "" && s.Version != "*" && len(s.comparators) == 0 && !isGlob(s.Version)
+}
+
+func (s PkgSpec) matchVersion(v Version) bool {
+	switch {
+	case s.Version == "" || s.Version == "*":
+		return true
+	case len(s.comparators) != 0:
+		for _, c := range s.comparators {
+			if !c.check(v) {
+				return false
+			}
+		}
+		return true
+	case isGlob(s.Version):
+		ok, _ := path.Match(s.Version, v.String())
+		return ok
+	default:
+		return v.Compare(NewVersionFromString(s.Version)) == 0
+	}
+}
+
+func (s PkgSpec) matchFlavor(n PkgName) bool {
+	if !s.HasFlavor {
+		// "foo-1.0" only matches the unflavored package, "foo->=1.0" matches any
+		return !s.isExact() || len(n.Flavors) == 0
+	}
+
+	if s.Flavor == "" {
+		return len(n.Flavors) == 0
+	}
+
+	flavors := strings.Split(s.Flavor, "-")
+	if s.isExact() && !strings.ContainsAny(s.Flavor, "!*") {
+		// plain name: same set of flavors, in any order
+		if len(flavors) != len(n.Flavors) {
+			return false
+		}
+		for _, f := range flavors {
+			if !n.HasFlavor(f) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, f := range flavors {
+		switch {
+		case f == "*":
+		case strings.HasPrefix(f, "!"):
+			if n.HasFlavor(f[1:]) {
+				return false
+			}
+		default:
+			if !n.HasFlavor(f) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Match reports whether the package name n satisfies the spec. The branch is
+// not considered since it can't be derived from a package name; use
+// MatchBranch when the package's pkgpath is known.
+func (s PkgSpec) Match(n PkgName) bool {
+	if isGlob(s.Stem) {
+		if ok, _ := path.Match(s.Stem, n.Stem); !ok {
+			return false
+		}
+	} else if s.Stem != n.Stem {
+		return false
+	}
+
+	return s.matchVersion(n.Version) && s.matchFlavor(n)
+}
+
+// MatchString is like Match but takes an unparsed package name
+func (s PkgSpec) MatchString(name string) bool {
+	n, err := NewPkgNameFromString(name)
+	if err != nil {
+		return false
+	}
+
+	return s.Match(n)
+}
+
+// MatchBranch is like Match but also checks the spec's branch (if any)
+// against the branch in the package's pkgpath.
+func (s PkgSpec) MatchBranch(n PkgName, pkgpath string) bool {
+	if s.Branch != "" && BranchFromPkgpath(pkgpath) != s.Branch {
+		return false
+	}
+
+	return s.Match(n)
+}
+
+func (s PkgSpec) String() string {
+	spec := s.Stem
+	if s.Version != "" || s.HasFlavor {
+		spec = fmt.Sprintf("%s-%s", spec, s.Version)
+	}
+	if s.HasFlavor {
+		spec = fmt.Sprintf("%s-%s", spec, s.Flavor)
+	}
+	if s.Branch != "" {
+		spec = fmt.Sprintf("%s%%%s", spec, s.Branch)
+	}
+
+	return spec
+}
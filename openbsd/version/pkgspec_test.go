@@ -0,0 +1,207 @@
+package version
+
+import (
+	"testing"
+)
+
+func TestPkgNameParsing(t *testing.T) {
+	tests := []struct {
+		name    string
+		stem    string
+		version string
+		flavor  string
+	}{
+		// examples from packages-specs(7)
+		{"mpeg_lib-1.3.1", "mpeg_lib", "1.3.1", ""},
+		{"kdelibs-3.1.4-debug-ipv6", "kdelibs", "3.1.4", "debug-ipv6"},
+		{"foo-1.0rc2", "foo", "1.0rc2", ""},
+		{"baz-1.0pl1", "baz", "1.0pl1", ""},
+		// the version starts at the first dash followed by a digit
+		{"p5-Net-SSLeay-1.92p0", "p5-Net-SSLeay", "1.92p0", ""},
+		{"py3-cryptography-41.0.7p0v0", "py3-cryptography", "41.0.7p0v0", ""},
+		{"vim-9.0.2092-gtk3-perl-python3-ruby", "vim", "9.0.2092", "gtk3-perl-python3-ruby"},
+		{"postgresql-server-15.4", "postgresql-server", "15.4", ""},
+		{"quirks-7.14", "quirks", "7.14", ""},
+		// trailing dash: explicitly no flavor
+		{"foo-1.0-", "foo", "1.0", ""},
+		// bare version
+		{"1.0p1", "", "1.0p1", ""},
+	}
+
+	for _, test := range tests {
+		n, err := NewPkgNameFromString(test.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if n.Stem != test.stem || n.Version.String() != test.version || n.Flavor() != test.flavor {
+			t.Errorf("%s: expected (%q, %q, %q), got (%q, %q, %q)", test.name,
+				test.stem, test.version, test.flavor, n.Stem, n.Version, n.Flavor())
+		}
+	}
+
+	for _, bad := range []string{"", "foo", "foo-bar", "foo-", "-"} {
+		if _, err := NewPkgNameFromString(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestPkgSpecParsing(t *testing.T) {
+	tests := []struct {
+		spec      string
+		stem      string
+		version   string
+		flavor    string
+		hasFlavor bool
+		branch    string
+	}{
+		{"foo", "foo", "", "", false, ""},
+		{"p5-Net-SSLeay", "p5-Net-SSLeay", "", "", false, ""},
+		{"foo-1.0", "foo", "1.0", "", false, ""},
+		{"foo-1.0-gtk", "foo", "1.0", "gtk", true, ""},
+		{"foo->=1.2", "foo", ">=1.2", "", false, ""},
+		{"foo-<2.0", "foo", "<2.0", "", false, ""},
+		{"foo->=1.0,<2.0", "foo", ">=1.0,<2.0", "", false, ""},
+		{"foo-*-gtk", "foo", "*", "gtk", true, ""},
+		{"foo-*-!gtk", "foo", "*", "!gtk", true, ""},
+		{"foo-1.*", "foo", "1.*", "", false, ""},
+		{"foo--", "foo", "", "", true, ""},
+		{"foo--gtk", "foo", "", "gtk", true, ""},
+		{"foo-*-", "foo", "*", "", true, ""},
+		{"python%3.11", "python", "", "", false, "3.11"},
+		{"python-*%3.11", "python", "*", "", false, "3.11"},
+		{"vim-*-no_x11%stable", "vim", "*", "no_x11", true, "stable"},
+	}
+
+	for _, test := range tests {
+		s, err := NewPkgSpecFromString(test.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.spec, err)
+			continue
+		}
+		if s.Stem != test.stem || s.Version != test.version || s.Flavor != test.flavor ||
+			s.HasFlavor != test.hasFlavor || s.Branch != test.branch {
+			t.Errorf("%s: expected (%q, %q, %q, %t, %q), got (%q, %q, %q, %t, %q)", test.spec,
+				test.stem, test.version, test.flavor, test.hasFlavor, test.branch,
+				s.Stem, s.Version, s.Flavor, s.HasFlavor, s.Branch)
+		}
+		if s.String() != test.spec {
+			t.Errorf("%s: String() round trip gave %q", test.spec, s.String())
+		}
+	}
+
+	for _, bad := range []string{"", "-1.0", "foo%", "foo->=abc", "foo->=1.0,", "foo-*-gtk--debug", "foo-[-"} {
+		if _, err := NewPkgSpecFromString(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestPkgSpecMatch(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		expected bool
+	}{
+		// stem only matches every version and flavor
+		{"foo", "foo-1.0", true},
+		{"foo", "foo-1.0-gtk", true},
+		{"foo", "foobar-1.0", false},
+		{"foo", "foo-bar-1.0", false},
+
+		// plain names
+		{"foo-1.0", "foo-1.0", true},
+		{"foo-1.1", "foo-1.01", true},
+		{"foo-1.0", "foo-1.0p0", false},
+		{"foo-1.0", "foo-1.0-gtk", false},
+		{"foo-1.0-gtk-debug", "foo-1.0-debug-gtk", true},
+		{"foo-1.0-gtk", "foo-1.0-debug-gtk", false},
+
+		// comparisons
+		{"foo->=1.2", "foo-1.2", true},
+		{"foo->=1.2", "foo-1.10", true},
+		{"foo->=1.2", "foo-1.1", false},
+		{"foo->=1.2", "foo-1.3-gtk", true},
+		{"foo-<2.0", "foo-1.9.9", true},
+		{"foo-<2.0", "foo-2.0", false},
+		{"foo-<2.0", "foo-2.0rc1", true},
+		{"foo-<=2.0", "foo-2.0", true},
+		{"foo->2.0", "foo-2.0p1", true},
+		{"foo->2.0", "foo-2.0", false},
+		{"foo-=1.01", "foo-1.1", true},
+		{"foo->=1.0,<2.0", "foo-1.5", true},
+		{"foo->=1.0,<2.0", "foo-2.1", false},
+		{"foo->=1.0,<2.0", "foo-0.9", false},
+		{"bar->=1.0beta3", "bar-1.0alpha5", false},
+		{"bar->=1.0beta3", "bar-1.0rc1", true},
+		{"baz->1.0", "baz-1.0pl1", true},
+
+		// globs
+		{"foo-1.*", "foo-1.0", true},
+		{"foo-1.*", "foo-1.2.3p4", true},
+		{"foo-1.*", "foo-10.0", false},
+		{"foo-1.*", "foo-1.0-gtk", true},
+		{"foo-*", "foo-3.2-gtk", true},
+		{"foo*-*", "foobar-3.2", true},
+		{"py3-*-*", "py3-cryptography-41.0.7", false},
+
+		// flavors
+		{"foo-*-gtk", "foo-1.0-gtk", true},
+		{"foo-*-gtk", "foo-1.0-gtk-debug", true},
+		{"foo-*-gtk", "foo-1.0", false},
+		{"foo-*-gtk", "foo-1.0-no_x11", false},
+		{"foo-*-!gtk", "foo-1.0", true},
+		{"foo-*-!gtk", "foo-1.0-gtk", false},
+		{"foo-*-!gtk", "foo-1.0-no_x11", true},
+		{"foo-*-*", "foo-1.0-no_x11", true},
+		{"foo--", "foo-1.0", true},
+		{"foo--", "foo-1.0-gtk", false},
+		{"foo-*-", "foo-2.0", true},
+		{"foo-*-", "foo-2.0-gtk", false},
+		{"foo--gtk", "foo-2.0-gtk", true},
+		{"foo--gtk", "foo-2.0", false},
+	}
+
+	for _, test := range tests {
+		s, err := NewPkgSpecFromString(test.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.spec, err)
+			continue
+		}
+		if res := s.MatchString(test.name); res != test.expected {
+			t.Errorf("%s matching %s: expected %t, got %t", test.spec, test.name, test.expected, res)
+		}
+	}
+}
+
+func TestPkgSpecMatchBranch(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		pkgpath  string
+		expected bool
+	}{
+		{"python%3.11", "python-3.11.7", "lang/python/3.11", true},
+		{"python%3.11", "python-3.10.13", "lang/python/3.10", false},
+		{"python%3.11", "python-3.11.7", "lang/python/3.11,-main", true},
+		{"python", "python-3.10.13", "lang/python/3.10", true},
+		{"postgresql-server%15", "postgresql-server-15.4", "databases/postgresql", false},
+	}
+
+	for _, test := range tests {
+		s, err := NewPkgSpecFromString(test.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.spec, err)
+			continue
+		}
+		n, err := NewPkgNameFromString(test.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if res := s.MatchBranch(n, test.pkgpath); res != test.expected {
+			t.Errorf("%s matching %s (%s): expected %t, got %t", test.spec, test.name, test.pkgpath, test.expected, res)
+		}
+	}
+}
@@ -37,6 +37,23 @@ func NewVersionFromString(versionStr string) Version {
 	return version
 }
 
+// ParseVersion is a strict version of NewVersionFromString: it returns an
+// error for malformed version strings instead of guessing.
+func ParseVersion(versionStr string) (Version, error) {
+	version := NewVersionFromString(versionStr)
+
+	// everything left after stripping p and v must be a valid dewey number
+	if _, err := ParseDewey(version.Dewey.String()); err != nil {
+		return Version{}, fmt.Errorf("invalid version: %q", versionStr)
+	}
+	// and must survive a round trip (rejects eg. "1.0p01" or "1.0vp1")
+	if version.String() != versionStr {
+		return Version{}, fmt.Errorf("invalid version: %q", versionStr)
+	}
+
+	return version, nil
+}
+
 func (v Version) String() string {
 	versionStr := v.Dewey.String()
 	if v.P != -1 {
@@ -48,6 +65,25 @@ func (v Version) String() string {
 	return versionStr
 }
 
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *Version) UnmarshalText(text []byte) error {
+	version, err := ParseVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*v = version
+
+	return nil
+}
+
+// Set implements flag.Value
+func (v *Version) Set(s string) error {
+	return v.UnmarshalText([]byte(s))
+}
+
 func (a Version) PnumCompare(b Version) int {
 	if a.P < b.P {
 		return -1
@@ -76,3 +112,16 @@ func (a Version) Compare(b Version) int {
 
 	return a.Dewey.Compare(b.Dewey)
 }
+
+// Compare is a.Compare(b) as a function, for use with sorting functions
+// such as slices.SortFunc
+func Compare(a, b Version) int {
+	return a.Compare(b)
+}
+
+// Versions implements sort.Interface, sorting from oldest to newest
+type Versions []Version
+
+func (v Versions) Len() int           { return len(v) }
+func (v Versions) Less(i, j int) bool { return v[i].Compare(v[j]) < 0 }
+func (v Versions) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
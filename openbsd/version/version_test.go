@@ -1,6 +1,8 @@
 package version
 
 import (
+	"encoding/json"
+	"flag"
 	debug2 "runtime/debug"
 	"testing"
 )
@@ -72,3 +74,52 @@ func TestVersionComparison(t *testing.T) {
 
 	checkVersion(t, "foo-80.1.1", "foo-80.1.1", 0)
 }
+
+func TestParseVersion(t *testing.T) {
+	for _, good := range []string{"1.0", "1.0p1", "1.0v2", "1.14.7p0v3", "1.0rc2", "1.0rc", "80.1aa", "2.9.0dev.12p0", "20240101"} {
+		v, err := ParseVersion(good)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", good, err)
+		} else if v.String() != good {
+			t.Errorf("%s: round trip gave %s", good, v)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "1..0", ".1", "1.", "1.0p01", "1.0-gtk", "v1", "p1"} {
+		if _, err := ParseVersion(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestVersionMarshalling(t *testing.T) {
+	type report struct {
+		Version Version
+		Dewey   Dewey
+	}
+
+	in := report{NewVersionFromString("1.14.7p0v3"), NewDeweyFromString("1.0rc2")}
+	b, err := json.Marshal(in)
+	checkErr(err)
+	if string(b) != `{"Version":"1.14.7p0v3","Dewey":"1.0rc2"}` {
+		t.Errorf("unexpected json: %s", b)
+	}
+
+	var out report
+	checkErr(json.Unmarshal(b, &out))
+	if out.Version.Compare(in.Version) != 0 || out.Dewey.Compare(in.Dewey) != 0 {
+		t.Errorf("round trip mismatch: %v != %v", out, in)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Version":"1.0-gtk"}`), &out); err == nil {
+		t.Errorf("expected error unmarshalling invalid version")
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var v Version
+	fs.Var(&v, "version", "version")
+	checkErr(fs.Parse([]string{"-version", "2.0p1"}))
+	if v.String() != "2.0p1" {
+		t.Errorf("unexpected flag value: %s", v)
+	}
+}